@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package codec provides payload encodings of MQTT requests and responses.
+// Only Fleet Provisioning accepts CBOR; the Device Shadow and Jobs MQTT APIs only accept JSON.
+package codec
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Codec encodes and decodes payloads.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+
+	// Format is the name of the payload format, such as "json" or "cbor".
+	// APIs which have a topic per payload format, like Fleet Provisioning, use it as the topic suffix.
+	Format() string
+}
+
+// JSON is the default codec.
+var JSON Codec = jsonCodec{}
+
+// CBOR encodes payloads as CBOR (RFC 8949). Struct fields are named by the "json" tags
+// unless "cbor" tags are specified, so request types can be used as is.
+var CBOR Codec = newCBORCodec()
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Format() string {
+	return "json"
+}
+
+type cborCodec struct {
+	enc cbor.EncMode
+	dec cbor.DecMode
+}
+
+func newCBORCodec() cborCodec {
+	enc, err := cbor.EncOptions{}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+	// decode maps to map[string]any like encoding/json.
+	dec, err := cbor.DecOptions{DefaultMapType: reflectMapStringAny}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return cborCodec{enc: enc, dec: dec}
+}
+
+func (c cborCodec) Marshal(v any) ([]byte, error) {
+	return c.enc.Marshal(v)
+}
+
+func (c cborCodec) Unmarshal(data []byte, v any) error {
+	return c.dec.Unmarshal(data, v)
+}
+
+func (cborCodec) Format() string {
+	return "cbor"
+}
+
+var reflectMapStringAny = reflect.TypeOf(map[string]any(nil))
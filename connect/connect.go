@@ -0,0 +1,244 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package connect creates a Paho mqtt.Client connected to AWS IoT Core.
+package connect
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/shirou/aws-iot-device-lib/internal/mqttutils"
+)
+
+const (
+	DefaultPort      = 8883
+	DefaultKeepAlive = 30 * time.Second
+)
+
+type ConnectionArgs struct {
+	// Optional. The default is TransportMQTT.
+	Transport Transport
+
+	// Optional. Transports to be tried in order. When a connection attempt fails, the next one is tried,
+	// on the first connection and on every reconnect. If specified, Transport is ignored.
+	Transports []Transport
+
+	// Path to the device certificate and the private key in PEM format.
+	// Required with TransportMQTT and TransportALPN.
+	Key  string
+	Cert string
+
+	// Optional. If set, it is used as the private key of Cert instead of Key,
+	// e.g. a hardware-backed key of connect/pkcs11.
+	Signer crypto.Signer
+
+	// Optional. If set, the client certificate is taken from the store on every handshake
+	// instead of Cert, Key and Signer, so it can be rotated by CertificateStore.Rotate.
+	CertificateStore *CertificateStore
+
+	// AWS credentials to sign the WebSocket URL. Required with TransportWebSocket.
+	// Credentials are retrieved on every connection attempt, so refreshed credentials are used after reconnect.
+	Credentials aws.CredentialsProvider
+
+	// Optional. The region to sign the WebSocket URL. If empty, it is taken from Endpoint.
+	Region string
+
+	// Optional. If set, the custom authorizer is used instead of the device certificate or SigV4.
+	// Only TransportALPN and TransportWebSocket can be used because custom authentication requires port 443.
+	CustomAuthorizer *CustomAuthorizer
+
+	// AWS IoT data endpoint, e.g. xxxxxxxx-ats.iot.ap-northeast-1.amazonaws.com.
+	Endpoint string
+
+	// Optional. Path to the CA certificate to verify the server. If empty, the system cert pool is used.
+	CAFile string
+
+	ThingName string
+
+	// Optional. The port of TransportMQTT. The default is 8883.
+	// TransportALPN and TransportWebSocket always use 443.
+	Port int
+
+	// Optional. The default is ThingName, as AWS IoT policies usually require.
+	ClientID string
+
+	// Optional. The default is 30 seconds.
+	KeepAlive time.Duration
+
+	// Optional. If true, the session is kept by the broker while disconnected (clean session = false).
+	PersistentSession bool
+
+	// Optional. The timeout to establish a connection. The default is paho's default.
+	ConnectTimeout time.Duration
+}
+
+func (args ConnectionArgs) clientID() string {
+	if args.ClientID != "" {
+		return args.ClientID
+	}
+	return args.ThingName
+}
+
+func getCertPool(pemPath string) (*x509.CertPool, error) {
+	certs := x509.NewCertPool()
+
+	pemData, err := os.ReadFile(pemPath)
+	if err != nil {
+		return nil, &Error{Op: "load CA", Path: pemPath, Err: err}
+	}
+	if !certs.AppendCertsFromPEM(pemData) {
+		return nil, &Error{Op: "load CA", Path: pemPath, Err: fmt.Errorf("no certificates found")}
+	}
+	return certs, nil
+}
+
+// getServerTLSConfig returns tls.Config which only verifies the server.
+func getServerTLSConfig(args ConnectionArgs) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: args.Endpoint,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	// CA
+	if args.CAFile != "" {
+		caPool, err := getCertPool(args.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = caPool
+	}
+	return tlsConfig, nil
+}
+
+// loadCertificate loads the certificate with the private key file or the signer.
+func loadCertificate(args ConnectionArgs) (tls.Certificate, error) {
+	if args.Signer == nil {
+		cert, err := tls.LoadX509KeyPair(args.Cert, args.Key)
+		if err != nil {
+			return cert, &Error{Op: "load certificate", Path: args.Cert, Err: err}
+		}
+		return cert, nil
+	}
+
+	var cert tls.Certificate
+	pemData, err := os.ReadFile(args.Cert)
+	if err != nil {
+		return cert, &Error{Op: "load certificate", Path: args.Cert, Err: err}
+	}
+	for {
+		var block *pem.Block
+		block, pemData = pem.Decode(pemData)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			cert.Certificate = append(cert.Certificate, block.Bytes)
+		}
+	}
+	if len(cert.Certificate) == 0 {
+		return cert, &Error{Op: "load certificate", Path: args.Cert, Err: fmt.Errorf("no certificates found")}
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return cert, &Error{Op: "load certificate", Path: args.Cert, Err: err}
+	}
+	pub, ok := leaf.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(args.Signer.Public()) {
+		return cert, &Error{Op: "load certificate", Path: args.Cert, Err: fmt.Errorf("public key does not match the signer")}
+	}
+	cert.PrivateKey = args.Signer
+	cert.Leaf = leaf
+	return cert, nil
+}
+
+func getTLSConfig(args ConnectionArgs) (*tls.Config, error) {
+	if args.CertificateStore != nil {
+		tlsConfig, err := getServerTLSConfig(args)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = args.CertificateStore.GetClientCertificate
+		return tlsConfig, nil
+	}
+	if args.Cert == "" || (args.Key == "" && args.Signer == nil) {
+		return nil, &Error{Op: "load certificate", Err: ErrNoCredentials}
+	}
+
+	tlsConfig, err := getServerTLSConfig(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cert and Private Key
+	cert, err := loadCertificate(args)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+
+	return tlsConfig, nil
+}
+
+// NewClientOptions returns ClientOptions to connect to AWS IoT Core. Handlers can be added before mqtt.NewClient.
+func NewClientOptions(args ConnectionArgs) (*mqtt.ClientOptions, error) {
+	if args.Endpoint == "" {
+		return nil, &Error{Op: "options", Err: ErrNoEndpoint}
+	}
+	if args.clientID() == "" {
+		return nil, &Error{Op: "options", Err: ErrNoClientID}
+	}
+
+	opt := mqtt.NewClientOptions()
+	opt.SetAutoReconnect(true)
+	opt.SetClientID(args.clientID())
+	opt.SetCleanSession(!args.PersistentSession)
+
+	keepAlive := args.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = DefaultKeepAlive
+	}
+	opt.SetKeepAlive(keepAlive)
+	if args.ConnectTimeout > 0 {
+		opt.SetConnectTimeout(args.ConnectTimeout)
+	}
+
+	if err := setTransports(opt, args); err != nil {
+		return nil, err
+	}
+	opt.SetOnConnectHandler(NotifyConnect)
+
+	return opt, nil
+}
+
+// NotifyConnect restores the subscriptions of the jobs and shadow packages after reconnect.
+// NewClientOptions sets it as the OnConnect handler. If the handler is replaced, call it from the new one.
+func NotifyConnect(mc mqtt.Client) {
+	mqttutils.NotifyConnect(mc)
+}
+
+// Connect connects to AWS IoT Core and returns the connected mqtt.Client.
+func Connect(args ConnectionArgs) (mqtt.Client, error) {
+	// 1. Get connection options
+	opts, err := NewClientOptions(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Set Paho MQTT client
+	mc := mqtt.NewClient(opts)
+
+	// 3. Connect to MQTT
+	if token := mc.Connect(); token.Wait() && token.Error() != nil {
+		return nil, &Error{Op: "connect", Path: args.Endpoint, Err: token.Error()}
+	}
+
+	return mc, nil
+}
@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: Apache-2.0
+package connect
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// customAuthALPNProtocol is the ALPN protocol name to use MQTT with a custom authorizer on port 443.
+const customAuthALPNProtocol = "mqtt"
+
+// CustomAuthorizer is the parameters to authenticate with an AWS IoT custom authorizer instead of X.509.
+// https://docs.aws.amazon.com/iot/latest/developerguide/custom-authentication.html
+type CustomAuthorizer struct {
+	// The name of the authorizer.
+	Name string
+
+	// Optional. The token and the name of the key to pass it. Required if the authorizer has a token key name.
+	TokenKeyName string
+	Token        string
+
+	// Optional. Path to the private key in PEM format to sign Token.
+	// Required if token signing is enabled on the authorizer.
+	SigningKeyFile string
+
+	// Optional. Passed to the authorizer in the MQTT CONNECT packet.
+	Username string
+	Password string
+}
+
+// signToken signs the token with the RSA private key and returns base64 encoded signature.
+func signToken(keyFile string, token string) (string, error) {
+	pemData, err := os.ReadFile(keyFile)
+	if err != nil {
+		return "", &Error{Op: "load signing key", Path: keyFile, Err: err}
+	}
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return "", &Error{Op: "load signing key", Path: keyFile, Err: fmt.Errorf("no PEM data found")}
+	}
+	var key any
+	if key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return "", &Error{Op: "load signing key", Path: keyFile, Err: err}
+		}
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return "", &Error{Op: "load signing key", Path: keyFile, Err: fmt.Errorf("unsupported key type %T", key)}
+	}
+
+	digest := sha256.Sum256([]byte(token))
+	sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return "", &Error{Op: "sign token", Err: err}
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// query returns the query parameters passed to the authorizer.
+func (auth *CustomAuthorizer) query() (url.Values, error) {
+	if auth.Name == "" {
+		return nil, &Error{Op: "options", Err: fmt.Errorf("custom authorizer name is not specified")}
+	}
+	q := url.Values{}
+	q.Set("x-amz-customauthorizer-name", auth.Name)
+	if auth.TokenKeyName != "" {
+		q.Set(auth.TokenKeyName, auth.Token)
+	}
+	if auth.SigningKeyFile != "" {
+		sig, err := signToken(auth.SigningKeyFile, auth.Token)
+		if err != nil {
+			return nil, err
+		}
+		q.Set("x-amz-customauthorizer-signature", sig)
+	}
+	return q, nil
+}
+
+// setCustomAuthorizer sets the username which contains the authorizer parameters as its query string,
+// because MQTT over TLS can not pass HTTP headers or query parameters.
+func setCustomAuthorizer(opt *mqtt.ClientOptions, args ConnectionArgs) error {
+	q, err := args.CustomAuthorizer.query()
+	if err != nil {
+		return err
+	}
+	opt.SetUsername(args.CustomAuthorizer.Username + "?" + q.Encode())
+	if args.CustomAuthorizer.Password != "" {
+		opt.SetPassword(args.CustomAuthorizer.Password)
+	}
+	return nil
+}
+
+// customAuthOpener returns openFunc for the transport authenticated with the custom authorizer.
+func customAuthOpener(args ConnectionArgs, t Transport) (openFunc, error) {
+	tlsConfig, err := getServerTLSConfig(args)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t {
+	case TransportALPN:
+		tlsConfig.NextProtos = []string{customAuthALPNProtocol}
+		return tlsOpener(tlsConfig), nil
+	case TransportWebSocket:
+		q, err := args.CustomAuthorizer.query()
+		if err != nil {
+			return nil, err
+		}
+		signed := fmt.Sprintf("wss://%s/mqtt?%s", args.Endpoint, q.Encode())
+		return func(uri *url.URL, options mqtt.ClientOptions) (net.Conn, error) {
+			return mqtt.NewWebsocket(signed, tlsConfig, options.ConnectTimeout, options.HTTPHeaders, options.WebsocketOptions)
+		}, nil
+	}
+	return nil, &Error{Op: "options", Err: fmt.Errorf("transport %s can not be used with custom authorizer", t)}
+}
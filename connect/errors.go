@@ -0,0 +1,34 @@
+// SPDX-License-Identifier: Apache-2.0
+package connect
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNoEndpoint is returned if ConnectionArgs.Endpoint is not specified.
+	ErrNoEndpoint = errors.New("endpoint is not specified")
+	// ErrNoClientID is returned if neither ConnectionArgs.ClientID nor ThingName is specified.
+	ErrNoClientID = errors.New("client id or thing name is not specified")
+	// ErrNoCredentials is returned if the certificate or the private key is not specified.
+	ErrNoCredentials = errors.New("certificate and private key are not specified")
+)
+
+// Error records an error and the operation and file that caused it.
+type Error struct {
+	Op   string
+	Path string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("connect: %s: %s", e.Op, e.Err)
+	}
+	return fmt.Sprintf("connect: %s %s: %s", e.Op, e.Path, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
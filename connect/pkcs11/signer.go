@@ -0,0 +1,342 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package pkcs11 provides a crypto.Signer backed by a PKCS#11 token, so that the private key of the
+// device certificate never leaves the hardware. It can be tested locally with SoftHSM.
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+	"unsafe"
+
+	p11 "github.com/miekg/pkcs11"
+)
+
+// Config specifies the token and the private key.
+type Config struct {
+	// Path to the PKCS#11 module, e.g. /usr/lib/softhsm/libsofthsm2.so.
+	Module string
+
+	// Label of the token.
+	TokenLabel string
+
+	// User PIN of the token.
+	PIN string
+
+	// Label or ID of the private key. At least one of them must be specified.
+	KeyLabel string
+	KeyID    []byte
+}
+
+// Signer is a crypto.Signer which signs with a private key in the token.
+type Signer struct {
+	ctx     *p11.Ctx
+	session p11.SessionHandle
+	key     p11.ObjectHandle
+	public  crypto.PublicKey
+
+	mu sync.Mutex // a session must not be used concurrently
+}
+
+var (
+	ErrTokenNotFound = errors.New("pkcs11: token not found")
+	ErrKeyNotFound   = errors.New("pkcs11: key not found")
+)
+
+// Open loads the module, logs in to the token and finds the private key. Close must be called after use.
+func Open(cfg Config) (*Signer, error) {
+	if cfg.KeyLabel == "" && len(cfg.KeyID) == 0 {
+		return nil, fmt.Errorf("pkcs11: key label or id is not specified")
+	}
+	ctx := p11.New(cfg.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("pkcs11: can not load module %s", cfg.Module)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("pkcs11: initialize: %w", err)
+	}
+	s := &Signer{ctx: ctx}
+	if err := s.open(cfg); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Signer) open(cfg Config) error {
+	slot, err := findSlot(s.ctx, cfg.TokenLabel)
+	if err != nil {
+		return err
+	}
+	if s.session, err = s.ctx.OpenSession(slot, p11.CKF_SERIAL_SESSION); err != nil {
+		return fmt.Errorf("pkcs11: open session: %w", err)
+	}
+	if err := s.ctx.Login(s.session, p11.CKU_USER, cfg.PIN); err != nil {
+		return fmt.Errorf("pkcs11: login: %w", err)
+	}
+
+	template := []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_CLASS, p11.CKO_PRIVATE_KEY),
+	}
+	if cfg.KeyLabel != "" {
+		template = append(template, p11.NewAttribute(p11.CKA_LABEL, cfg.KeyLabel))
+	}
+	if len(cfg.KeyID) > 0 {
+		template = append(template, p11.NewAttribute(p11.CKA_ID, cfg.KeyID))
+	}
+	if s.key, err = findObject(s.ctx, s.session, template); err != nil {
+		return err
+	}
+
+	if s.public, err = s.publicKey(cfg); err != nil {
+		return err
+	}
+	return nil
+}
+
+func findSlot(ctx *p11.Ctx, label string) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("pkcs11: get slot list: %w", err)
+	}
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			continue
+		}
+		if info.Label == label {
+			return slot, nil
+		}
+	}
+	return 0, ErrTokenNotFound
+}
+
+func findObject(ctx *p11.Ctx, session p11.SessionHandle, template []*p11.Attribute) (p11.ObjectHandle, error) {
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		return 0, fmt.Errorf("pkcs11: find objects: %w", err)
+	}
+	objs, _, err := ctx.FindObjects(session, 1)
+	if finalErr := ctx.FindObjectsFinal(session); err == nil {
+		err = finalErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("pkcs11: find objects: %w", err)
+	}
+	if len(objs) == 0 {
+		return 0, ErrKeyNotFound
+	}
+	return objs[0], nil
+}
+
+// publicKey reads the public key. RSA public key is read from the private key object,
+// and EC public key is read from the public key object which has the same label or id.
+func (s *Signer) publicKey(cfg Config) (crypto.PublicKey, error) {
+	attrs, err := s.ctx.GetAttributeValue(s.session, s.key, []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_KEY_TYPE, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: get key type: %w", err)
+	}
+	keyType, err := bytesToUint(attrs[0].Value)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: get key type: %w", err)
+	}
+
+	switch keyType {
+	case p11.CKK_RSA:
+		attrs, err := s.ctx.GetAttributeValue(s.session, s.key, []*p11.Attribute{
+			p11.NewAttribute(p11.CKA_MODULUS, nil),
+			p11.NewAttribute(p11.CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("pkcs11: get RSA public key: %w", err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(attrs[0].Value),
+			E: int(new(big.Int).SetBytes(attrs[1].Value).Int64()),
+		}, nil
+	case p11.CKK_EC:
+		template := []*p11.Attribute{
+			p11.NewAttribute(p11.CKA_CLASS, p11.CKO_PUBLIC_KEY),
+		}
+		if cfg.KeyLabel != "" {
+			template = append(template, p11.NewAttribute(p11.CKA_LABEL, cfg.KeyLabel))
+		}
+		if len(cfg.KeyID) > 0 {
+			template = append(template, p11.NewAttribute(p11.CKA_ID, cfg.KeyID))
+		}
+		pub, err := findObject(s.ctx, s.session, template)
+		if err != nil {
+			return nil, fmt.Errorf("pkcs11: EC public key: %w", err)
+		}
+		attrs, err := s.ctx.GetAttributeValue(s.session, pub, []*p11.Attribute{
+			p11.NewAttribute(p11.CKA_EC_PARAMS, nil),
+			p11.NewAttribute(p11.CKA_EC_POINT, nil),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("pkcs11: get EC public key: %w", err)
+		}
+		return parseECPublicKey(attrs[0].Value, attrs[1].Value)
+	}
+	return nil, fmt.Errorf("pkcs11: unsupported key type %d", keyType)
+}
+
+var curveOIDs = map[string]elliptic.Curve{
+	asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}.String(): elliptic.P256(),
+	asn1.ObjectIdentifier{1, 3, 132, 0, 34}.String():          elliptic.P384(),
+	asn1.ObjectIdentifier{1, 3, 132, 0, 35}.String():          elliptic.P521(),
+}
+
+func parseECPublicKey(params []byte, point []byte) (*ecdsa.PublicKey, error) {
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(params, &oid); err != nil {
+		return nil, fmt.Errorf("pkcs11: parse EC params: %w", err)
+	}
+	curve, ok := curveOIDs[oid.String()]
+	if !ok {
+		return nil, fmt.Errorf("pkcs11: unsupported curve %s", oid)
+	}
+	// CKA_EC_POINT is a DER encoded OCTET STRING of the uncompressed point.
+	var raw []byte
+	if _, err := asn1.Unmarshal(point, &raw); err != nil {
+		raw = point
+	}
+	x, y := elliptic.Unmarshal(curve, raw)
+	if x == nil {
+		return nil, fmt.Errorf("pkcs11: invalid EC point")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// nativeEndian is the byte order of CK_ULONG attribute values, which is the one of the platform.
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// bytesToUint decodes a CK_ULONG attribute value. Its size is 4 or 8 bytes depending on the platform.
+func bytesToUint(b []byte) (uint, error) {
+	switch len(b) {
+	case 4:
+		return uint(nativeEndian.Uint32(b)), nil
+	case 8:
+		return uint(nativeEndian.Uint64(b)), nil
+	}
+	return 0, fmt.Errorf("invalid CK_ULONG size %d", len(b))
+}
+
+// Public returns the public key of the private key.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign signs the digest with the private key in the token. RSA PKCS#1 v1.5, RSA-PSS and ECDSA are supported.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	switch s.public.(type) {
+	case *rsa.PublicKey:
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			return s.signRSAPSS(digest, pss)
+		}
+		return s.signRSA(digest, opts.HashFunc())
+	case *ecdsa.PublicKey:
+		return s.signECDSA(digest)
+	}
+	return nil, fmt.Errorf("pkcs11: unsupported key")
+}
+
+func (s *Signer) sign(mechanism *p11.Mechanism, data []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.ctx.SignInit(s.session, []*p11.Mechanism{mechanism}, s.key); err != nil {
+		return nil, fmt.Errorf("pkcs11: sign init: %w", err)
+	}
+	sig, err := s.ctx.Sign(s.session, data)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: sign: %w", err)
+	}
+	return sig, nil
+}
+
+// digestInfoPrefix is the DER prefix of DigestInfo for PKCS#1 v1.5 signature.
+var digestInfoPrefix = map[crypto.Hash][]byte{
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+func (s *Signer) signRSA(digest []byte, hash crypto.Hash) ([]byte, error) {
+	prefix, ok := digestInfoPrefix[hash]
+	if !ok {
+		return nil, fmt.Errorf("pkcs11: unsupported hash %s", hash)
+	}
+	data := append(append([]byte{}, prefix...), digest...)
+	return s.sign(p11.NewMechanism(p11.CKM_RSA_PKCS, nil), data)
+}
+
+var pssMechanisms = map[crypto.Hash][2]uint{
+	crypto.SHA256: {p11.CKM_SHA256, p11.CKG_MGF1_SHA256},
+	crypto.SHA384: {p11.CKM_SHA384, p11.CKG_MGF1_SHA384},
+	crypto.SHA512: {p11.CKM_SHA512, p11.CKG_MGF1_SHA512},
+}
+
+func (s *Signer) signRSAPSS(digest []byte, opts *rsa.PSSOptions) ([]byte, error) {
+	hash := opts.HashFunc()
+	mech, ok := pssMechanisms[hash]
+	if !ok {
+		return nil, fmt.Errorf("pkcs11: unsupported hash %s", hash)
+	}
+	saltLength := opts.SaltLength
+	if saltLength == rsa.PSSSaltLengthEqualsHash || saltLength == rsa.PSSSaltLengthAuto {
+		saltLength = hash.Size()
+	}
+	params := p11.NewPSSParams(mech[0], mech[1], uint(saltLength))
+	return s.sign(p11.NewMechanism(p11.CKM_RSA_PKCS_PSS, params), digest)
+}
+
+func (s *Signer) signECDSA(digest []byte) ([]byte, error) {
+	sig, err := s.sign(p11.NewMechanism(p11.CKM_ECDSA, nil), digest)
+	if err != nil {
+		return nil, err
+	}
+	// PKCS#11 returns r || s, but crypto.Signer must return ASN.1 DER.
+	half := len(sig) / 2
+	return asn1.Marshal(struct {
+		R, S *big.Int
+	}{
+		R: new(big.Int).SetBytes(sig[:half]),
+		S: new(big.Int).SetBytes(sig[half:]),
+	})
+}
+
+// Close logs out and unloads the module.
+func (s *Signer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	if s.session != 0 {
+		s.ctx.Logout(s.session)
+		err = s.ctx.CloseSession(s.session)
+		s.session = 0
+	}
+	if s.ctx != nil {
+		s.ctx.Finalize()
+		s.ctx.Destroy()
+		s.ctx = nil
+	}
+	return err
+}
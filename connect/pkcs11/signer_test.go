@@ -0,0 +1,228 @@
+// SPDX-License-Identifier: Apache-2.0
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	p11 "github.com/miekg/pkcs11"
+)
+
+const (
+	testTokenLabel = "aws-iot-device-lib-test"
+	testSOPIN      = "12345678"
+	testPIN        = "1234"
+)
+
+// softHSMModules are the paths of the SoftHSM module on common distributions.
+// SOFTHSM2_MODULE overrides them.
+var softHSMModules = []string{
+	"/usr/lib/softhsm/libsofthsm2.so",
+	"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/lib/aarch64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/lib64/pkcs11/libsofthsm2.so",
+	"/usr/local/lib/softhsm/libsofthsm2.so",
+	"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+}
+
+func TestBytesToUint(t *testing.T) {
+	// NewAttribute encodes CK_ULONG in the native byte order of the platform.
+	for _, v := range []uint{p11.CKK_RSA, p11.CKK_EC, 0x01020304} {
+		got, err := bytesToUint(p11.NewAttribute(p11.CKA_KEY_TYPE, v).Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != v {
+			t.Errorf("bytesToUint = %#x, want %#x", got, v)
+		}
+	}
+	if _, err := bytesToUint([]byte{1, 2}); err == nil {
+		t.Error("invalid size must fail")
+	}
+}
+
+// softHSM returns the path of the SoftHSM module with an empty token directory, or skips the test.
+func softHSM(t *testing.T) string {
+	t.Helper()
+	module := os.Getenv("SOFTHSM2_MODULE")
+	if module == "" {
+		for _, path := range softHSMModules {
+			if _, err := os.Stat(path); err == nil {
+				module = path
+				break
+			}
+		}
+	}
+	if module == "" {
+		t.Skip("SoftHSM is not available, set SOFTHSM2_MODULE to run")
+	}
+
+	dir := t.TempDir()
+	tokens := filepath.Join(dir, "tokens")
+	if err := os.Mkdir(tokens, 0700); err != nil {
+		t.Fatal(err)
+	}
+	conf := filepath.Join(dir, "softhsm2.conf")
+	if err := os.WriteFile(conf, []byte("directories.tokendir = "+tokens+"\nobjectstore.backend = file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOFTHSM2_CONF", conf)
+	return module
+}
+
+// initToken initializes a token and generates an EC P-256 key pair labeled "ec"
+// and an RSA 2048 key pair labeled "rsa".
+func initToken(t *testing.T, module string) {
+	t.Helper()
+	ctx := p11.New(module)
+	if ctx == nil {
+		t.Fatalf("can not load %s", module)
+	}
+	defer ctx.Destroy()
+	if err := ctx.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Finalize()
+
+	slots, err := ctx.GetSlotList(false)
+	if err != nil || len(slots) == 0 {
+		t.Fatalf("no slot: %v", err)
+	}
+	if err := ctx.InitToken(slots[0], testSOPIN, testTokenLabel); err != nil {
+		t.Fatal(err)
+	}
+	// SoftHSM reassigns the slot of an initialized token.
+	slot, err := findSlot(ctx, testTokenLabel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := ctx.OpenSession(slot, p11.CKF_SERIAL_SESSION|p11.CKF_RW_SESSION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.CloseSession(session)
+
+	if err := ctx.Login(session, p11.CKU_SO, testSOPIN); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.InitPIN(session, testPIN); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.Logout(session); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.Login(session, p11.CKU_USER, testPIN); err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Logout(session)
+
+	private := func(label string) []*p11.Attribute {
+		return []*p11.Attribute{
+			p11.NewAttribute(p11.CKA_TOKEN, true),
+			p11.NewAttribute(p11.CKA_PRIVATE, true),
+			p11.NewAttribute(p11.CKA_SENSITIVE, true),
+			p11.NewAttribute(p11.CKA_SIGN, true),
+			p11.NewAttribute(p11.CKA_LABEL, label),
+		}
+	}
+
+	p256, err := asn1.Marshal(asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ctx.GenerateKeyPair(session,
+		[]*p11.Mechanism{p11.NewMechanism(p11.CKM_EC_KEY_PAIR_GEN, nil)},
+		[]*p11.Attribute{
+			p11.NewAttribute(p11.CKA_TOKEN, true),
+			p11.NewAttribute(p11.CKA_VERIFY, true),
+			p11.NewAttribute(p11.CKA_EC_PARAMS, p256),
+			p11.NewAttribute(p11.CKA_LABEL, "ec"),
+		},
+		private("ec"),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := ctx.GenerateKeyPair(session,
+		[]*p11.Mechanism{p11.NewMechanism(p11.CKM_RSA_PKCS_KEY_PAIR_GEN, nil)},
+		[]*p11.Attribute{
+			p11.NewAttribute(p11.CKA_TOKEN, true),
+			p11.NewAttribute(p11.CKA_VERIFY, true),
+			p11.NewAttribute(p11.CKA_MODULUS_BITS, 2048),
+			p11.NewAttribute(p11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}),
+			p11.NewAttribute(p11.CKA_LABEL, "rsa"),
+		},
+		private("rsa"),
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignerSoftHSM(t *testing.T) {
+	module := softHSM(t)
+	initToken(t, module)
+
+	digest := sha256.Sum256([]byte("hello"))
+	open := func(t *testing.T, label string) *Signer {
+		t.Helper()
+		s, err := Open(Config{Module: module, TokenLabel: testTokenLabel, PIN: testPIN, KeyLabel: label})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	}
+
+	t.Run("ECDSA", func(t *testing.T) {
+		s := open(t, "ec")
+		pub, ok := s.Public().(*ecdsa.PublicKey)
+		if !ok {
+			t.Fatalf("public key is %T", s.Public())
+		}
+		sig, err := s.Sign(nil, digest[:], crypto.SHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ecdsa.VerifyASN1(pub, digest[:], sig) {
+			t.Error("invalid signature")
+		}
+	})
+
+	t.Run("RSA", func(t *testing.T) {
+		s := open(t, "rsa")
+		pub, ok := s.Public().(*rsa.PublicKey)
+		if !ok {
+			t.Fatalf("public key is %T", s.Public())
+		}
+		sig, err := s.Sign(nil, digest[:], crypto.SHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+			t.Error(err)
+		}
+
+		opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+		sig, err = s.Sign(nil, digest[:], opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rsa.VerifyPSS(pub, crypto.SHA256, digest[:], sig, opts); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("KeyNotFound", func(t *testing.T) {
+		_, err := Open(Config{Module: module, TokenLabel: testTokenLabel, PIN: testPIN, KeyLabel: "missing"})
+		if !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Open = %v, want ErrKeyNotFound", err)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: Apache-2.0
+package connect
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/shirou/aws-iot-device-lib/internal/mqttutils"
+)
+
+// disconnectQuiesce is the time in milliseconds to wait for the work to complete before disconnecting.
+const disconnectQuiesce = 250
+
+// CertificateStore holds the client certificate used for new connections. The TLS config gets the certificate
+// from the store on every handshake, so the certificate can be swapped without recreating the client.
+type CertificateStore struct {
+	mu       sync.RWMutex
+	args     ConnectionArgs
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+// NewCertificateStore loads the certificate from args.Cert and args.Key (or args.Signer).
+// Set it to ConnectionArgs.CertificateStore to use it.
+func NewCertificateStore(args ConnectionArgs) (*CertificateStore, error) {
+	store := &CertificateStore{}
+	if err := store.load(args); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func modTimes(args ConnectionArgs) [2]time.Time {
+	var ret [2]time.Time
+	for i, path := range []string{args.Cert, args.Key} {
+		if path == "" {
+			continue
+		}
+		if fi, err := os.Stat(path); err == nil {
+			ret[i] = fi.ModTime()
+		}
+	}
+	return ret
+}
+
+// load loads the certificate of args and swaps the current one.
+func (store *CertificateStore) load(args ConnectionArgs) error {
+	if args.Cert == "" || (args.Key == "" && args.Signer == nil) {
+		return &Error{Op: "load certificate", Err: ErrNoCredentials}
+	}
+	cert, err := loadCertificate(args)
+	if err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.args = args
+	store.cert = &cert
+	store.modTimes = modTimes(args)
+	return nil
+}
+
+// GetClientCertificate returns the current certificate. It is used as tls.Config.GetClientCertificate.
+func (store *CertificateStore) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return store.cert, nil
+}
+
+// current returns the current args and certificate.
+func (store *CertificateStore) current() (ConnectionArgs, *tls.Certificate) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return store.args, store.cert
+}
+
+// Rotate loads the new certificate and private key, swaps them and forces a clean reconnect of mc
+// so that the new certificate is used immediately. If the reconnect fails, the previous certificate
+// is restored and reconnected. Subscriptions of the jobs and shadow packages are restored after the reconnect.
+// If keyFile is empty, the Signer of the store is kept, e.g. to renew the certificate of a key in an HSM.
+// Otherwise the Signer is cleared and the private key is loaded from keyFile.
+func (store *CertificateStore) Rotate(ctx context.Context, mc mqtt.Client, certFile string, keyFile string) error {
+	prevArgs, prevCert := store.current()
+	args := prevArgs
+	args.Cert = certFile
+	args.Key = keyFile
+	if keyFile != "" {
+		args.Signer = nil
+	}
+	if err := store.load(args); err != nil {
+		return err
+	}
+
+	if err := reconnect(ctx, mc); err != nil {
+		store.mu.Lock()
+		store.args = prevArgs
+		store.cert = prevCert
+		store.modTimes = modTimes(prevArgs)
+		store.mu.Unlock()
+
+		return mqttutils.JoinErrors(
+			&Error{Op: "rotate", Path: certFile, Err: err},
+			reconnect(ctx, mc),
+		)
+	}
+	return nil
+}
+
+// Watch polls the certificate and key files with the interval, and reloads them and reconnects mc
+// when they are modified, until ctx is done. Errors are passed to onError if it is not nil.
+func (store *CertificateStore) Watch(ctx context.Context, mc mqtt.Client, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			args, _ := store.current()
+			store.mu.RLock()
+			changed := modTimes(args) != store.modTimes
+			store.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := store.Rotate(ctx, mc, args.Cert, args.Key); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// reconnect disconnects and connects again. Disconnect does not trigger the auto reconnect of paho.
+func reconnect(ctx context.Context, mc mqtt.Client) error {
+	if mc.IsConnectionOpen() {
+		mc.Disconnect(disconnectQuiesce)
+	}
+	token := mc.Connect()
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
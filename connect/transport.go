@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: Apache-2.0
+package connect
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Transport is the way to connect to AWS IoT Core.
+type Transport int
+
+const (
+	// TransportMQTT is MQTT over mutual TLS on port 8883, authenticated with the device certificate.
+	TransportMQTT Transport = iota
+	// TransportWebSocket is MQTT over WebSockets on port 443, authenticated with SigV4 signed URL.
+	TransportWebSocket
+	// TransportALPN is MQTT over mutual TLS on port 443 with the x-amzn-mqtt-ca ALPN protocol,
+	// for networks which block 8883.
+	TransportALPN
+)
+
+// alpnProtocol is the ALPN protocol name to use MQTT with client certificates on port 443.
+const alpnProtocol = "x-amzn-mqtt-ca"
+
+func (t Transport) String() string {
+	switch t {
+	case TransportMQTT:
+		return "mqtt"
+	case TransportWebSocket:
+		return "websocket"
+	case TransportALPN:
+		return "alpn"
+	}
+	return fmt.Sprintf("Transport(%d)", int(t))
+}
+
+func (args ConnectionArgs) transports() []Transport {
+	if len(args.Transports) > 0 {
+		return args.Transports
+	}
+	return []Transport{args.Transport}
+}
+
+// brokerURL returns the broker URL of the transport. Each transport has a distinct URL
+// so that the connection can be opened by the transport of the URL.
+func (args ConnectionArgs) brokerURL(t Transport) string {
+	switch t {
+	case TransportMQTT:
+		port := args.Port
+		if port == 0 {
+			port = DefaultPort
+		}
+		return fmt.Sprintf("ssl://%s:%d", args.Endpoint, port)
+	case TransportALPN:
+		return fmt.Sprintf("ssl://%s:443", args.Endpoint)
+	case TransportWebSocket:
+		return fmt.Sprintf("wss://%s:443/mqtt", args.Endpoint)
+	}
+	return ""
+}
+
+// openFunc opens a network connection of a transport.
+type openFunc func(uri *url.URL, options mqtt.ClientOptions) (net.Conn, error)
+
+// tlsOpener returns openFunc to connect with mutual TLS.
+func tlsOpener(tlsConfig *tls.Config) openFunc {
+	return func(uri *url.URL, options mqtt.ClientOptions) (net.Conn, error) {
+		dialer := options.Dialer
+		if dialer == nil {
+			dialer = &net.Dialer{Timeout: options.ConnectTimeout}
+		}
+		conn, err := tls.DialWithDialer(dialer, "tcp", uri.Host, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+func newOpener(args ConnectionArgs, t Transport) (openFunc, error) {
+	if args.CustomAuthorizer != nil {
+		return customAuthOpener(args, t)
+	}
+
+	switch t {
+	case TransportMQTT:
+		tlsConfig, err := getTLSConfig(args)
+		if err != nil {
+			return nil, err
+		}
+		return tlsOpener(tlsConfig), nil
+	case TransportALPN:
+		tlsConfig, err := getTLSConfig(args)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.NextProtos = []string{alpnProtocol}
+		return tlsOpener(tlsConfig), nil
+	case TransportWebSocket:
+		return webSocketOpener(args)
+	}
+	return nil, &Error{Op: "options", Err: fmt.Errorf("unknown transport %s", t)}
+}
+
+// setTransports adds a broker per transport in order. Paho tries the brokers in order on every connection
+// attempt, so the next transport is used when the previous one fails.
+func setTransports(opt *mqtt.ClientOptions, args ConnectionArgs) error {
+	openers := make(map[string]openFunc)
+	for _, t := range args.transports() {
+		broker := args.brokerURL(t)
+		if _, ok := openers[broker]; ok {
+			return &Error{Op: "options", Err: fmt.Errorf("transport %s is specified twice", t)}
+		}
+		open, err := newOpener(args, t)
+		if err != nil {
+			return err
+		}
+		openers[broker] = open
+		opt.AddBroker(broker)
+	}
+
+	if args.CustomAuthorizer != nil {
+		if err := setCustomAuthorizer(opt, args); err != nil {
+			return err
+		}
+	}
+
+	opt.SetCustomOpenConnectionFn(func(uri *url.URL, options mqtt.ClientOptions) (net.Conn, error) {
+		open, ok := openers[uri.String()]
+		if !ok {
+			return nil, &Error{Op: "connect", Path: uri.String(), Err: fmt.Errorf("unknown broker")}
+		}
+		return open(uri, options)
+	})
+	return nil
+}
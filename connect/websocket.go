@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: Apache-2.0
+package connect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	// signingService is the service name of the AWS IoT data endpoint for SigV4.
+	signingService = "iotdevicegateway"
+	// emptyPayloadHash is the SHA-256 hash of the empty payload.
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+var ErrNoAWSCredentials = errors.New("AWS credentials are not specified")
+
+// regionFromEndpoint extracts the region from an endpoint like xxxxxxxx-ats.iot.ap-northeast-1.amazonaws.com.
+func regionFromEndpoint(endpoint string) string {
+	parts := strings.Split(endpoint, ".")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "iot" {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
+// presignURL returns the wss URL signed with SigV4.
+// The session token is appended after signing because AWS IoT does not include it in the signature.
+func presignURL(ctx context.Context, endpoint string, region string, creds aws.Credentials, now time.Time) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "wss://"+endpoint+"/mqtt", nil)
+	if err != nil {
+		return "", err
+	}
+
+	sessionToken := creds.SessionToken
+	creds.SessionToken = ""
+	signed, _, err := v4.NewSigner().PresignHTTP(ctx, creds, req, emptyPayloadHash, signingService, region, now)
+	if err != nil {
+		return "", err
+	}
+	if sessionToken != "" {
+		signed += "&X-Amz-Security-Token=" + url.QueryEscape(sessionToken)
+	}
+	return signed, nil
+}
+
+// webSocketOpener returns openFunc to connect over WebSockets. The URL is signed on every connection attempt.
+func webSocketOpener(args ConnectionArgs) (openFunc, error) {
+	if args.Credentials == nil {
+		return nil, &Error{Op: "options", Err: ErrNoAWSCredentials}
+	}
+	region := args.Region
+	if region == "" {
+		region = regionFromEndpoint(args.Endpoint)
+	}
+	if region == "" {
+		return nil, &Error{Op: "options", Err: fmt.Errorf("region is not specified and can not be taken from %s", args.Endpoint)}
+	}
+
+	tlsConfig, err := getServerTLSConfig(args)
+	if err != nil {
+		return nil, err
+	}
+	return func(uri *url.URL, options mqtt.ClientOptions) (net.Conn, error) {
+		ctx := context.Background()
+		if options.ConnectTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, options.ConnectTimeout)
+			defer cancel()
+		}
+
+		creds, err := args.Credentials.Retrieve(ctx)
+		if err != nil {
+			return nil, &Error{Op: "retrieve credentials", Err: err}
+		}
+		signed, err := presignURL(ctx, args.Endpoint, region, creds, time.Now())
+		if err != nil {
+			return nil, &Error{Op: "sign", Err: err}
+		}
+		return mqtt.NewWebsocket(signed, tlsConfig, options.ConnectTimeout, options.HTTPHeaders, options.WebsocketOptions)
+	}, nil
+}
@@ -4,11 +4,12 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
+	"os/signal"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/service/iotjobsdataplane"
 	"github.com/aws/aws-sdk-go-v2/service/iotjobsdataplane/types"
-	"github.com/shirou/aws-iot-device-lib/examples/connect"
+	"github.com/shirou/aws-iot-device-lib/connect"
 	"github.com/shirou/aws-iot-device-lib/jobs"
 	"github.com/urfave/cli/v2"
 )
@@ -67,7 +68,7 @@ func GetPendingJobExecutions(cCtx *cli.Context) error {
 	}
 
 	thingName := cCtx.String("thing_name")
-	req := iotjobsdataplane.GetPendingJobExecutionsInput{}
+	req := jobs.GetPendingJobExecutionsInput{}
 
 	ctx := context.Background()
 	ret, err := client.GetPendingJobExecutions(ctx, thingName, req)
@@ -92,7 +93,7 @@ func StartNextPendingJobExecution(cCtx *cli.Context) error {
 	}
 	thingName := cCtx.String("thing_name")
 
-	req := iotjobsdataplane.StartNextPendingJobExecutionInput{}
+	req := jobs.StartNextPendingJobExecutionInput{}
 
 	ctx := context.Background()
 	ret, err := client.StartNextPendingJobExecution(ctx, thingName, req)
@@ -157,10 +158,7 @@ func JobExecutionsChanged(cCtx *cli.Context) error {
 		}
 		return nil
 	}
-	go client.JobExecutionsChanged(ctx, thingName, callback)
-
-	<-ctx.Done()
-	return ctx.Err()
+	return client.JobExecutionsChanged(ctx, thingName, callback)
 }
 
 func NextJobExecutionChanged(cCtx *cli.Context) error {
@@ -174,8 +172,32 @@ func NextJobExecutionChanged(cCtx *cli.Context) error {
 	callback := func(client *jobs.Client, msg jobs.NextJobExecutionChangedMessage) error {
 		return nil
 	}
-	go client.NextJobExecutionChanged(ctx, cCtx.String("thing_name"), callback)
+	return client.NextJobExecutionChanged(ctx, cCtx.String("thing_name"), callback)
+}
+
+func Agent(cCtx *cli.Context) error {
+	client, err := getJobsClient(cCtx)
+	if err != nil {
+		return err
+	}
+
+	agent, err := jobs.NewAgent(client, cCtx.String("thing_name"))
+	if err != nil {
+		return err
+	}
+	agent.StepTimeout = 10 * time.Minute
+	agent.OnError = func(err error) {
+		fmt.Println(err)
+	}
+	// runs every job regardless of the operation
+	agent.Handle("", func(ctx context.Context, job *jobs.JobExecution) (map[string]string, error) {
+		for _, step := range job.JobDocument.Steps {
+			fmt.Printf("step: %s\n", step.Action.Name)
+		}
+		return map[string]string{"steps": fmt.Sprint(len(job.JobDocument.Steps))}, nil
+	})
 
-	<-ctx.Done()
-	return ctx.Err()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return agent.Run(ctx)
 }
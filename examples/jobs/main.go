@@ -12,7 +12,7 @@ func main() {
 	flags := []cli.Flag{
 		&cli.StringFlag{Name: "key", Required: true},
 		&cli.StringFlag{Name: "cert", Required: true},
-		&cli.StringFlag{Name: "ca_file", Required: true},
+		&cli.StringFlag{Name: "ca_file", Usage: "CA file. the system cert pool is used if not specified"},
 		&cli.StringFlag{Name: "thing_name", Value: "", Usage: ""},
 		&cli.StringFlag{Name: "endpoint", Value: "", Required: true},
 		&cli.IntFlag{Name: "port", Value: 8883, Usage: "port number"},
@@ -55,6 +55,10 @@ func main() {
 				Name:   "NextJobExecutionChanged",
 				Action: NextJobExecutionChanged,
 			},
+			{
+				Name:   "Agent",
+				Action: Agent,
+			},
 		},
 	}
 
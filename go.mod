@@ -7,7 +7,9 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/iotjobsdataplane v1.11.21
 	github.com/aws/smithy-go v1.13.5
 	github.com/eclipse/paho.mqtt.golang v1.4.2
+	github.com/fxamacker/cbor/v2 v2.7.0
 	github.com/google/uuid v1.3.0
+	github.com/miekg/pkcs11 v1.1.1
 	github.com/urfave/cli/v2 v2.23.7
 )
 
@@ -17,6 +19,7 @@ require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.2 // indirect
 	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 	github.com/xrash/smetrics v0.0.0-20201216005158-039620a65673 // indirect
 	golang.org/x/net v0.0.0-20200425230154-ff2c4b7c35a0 // indirect
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
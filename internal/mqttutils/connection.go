@@ -0,0 +1,96 @@
+package mqttutils
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// connectHooks are functions called every time the client is connected, keyed by the client.
+var connectHooks = struct {
+	sync.Mutex
+	m map[mqtt.Client]map[*func()]struct{}
+}{
+	m: make(map[mqtt.Client]map[*func()]struct{}),
+}
+
+// OnConnect registers fn to be called every time the client is connected. NotifyConnect must be called
+// from the OnConnect handler of the client, otherwise fn is never called. It returns a function to unregister.
+func OnConnect(cli mqtt.Client, fn func()) (remove func()) {
+	key := &fn
+
+	connectHooks.Lock()
+	defer connectHooks.Unlock()
+	hooks, ok := connectHooks.m[cli]
+	if !ok {
+		hooks = make(map[*func()]struct{})
+		connectHooks.m[cli] = hooks
+	}
+	hooks[key] = struct{}{}
+
+	return func() {
+		connectHooks.Lock()
+		defer connectHooks.Unlock()
+		delete(connectHooks.m[cli], key)
+		if len(connectHooks.m[cli]) == 0 {
+			delete(connectHooks.m, cli)
+		}
+	}
+}
+
+// NotifyConnect re-establishes the subscriptions registered by Register, and calls the functions registered
+// by OnConnect. It is called from mqtt.OnConnectHandler.
+func NotifyConnect(cli mqtt.Client) {
+	// the subscriptions are re-established before the hooks, which may rely on them.
+	resubscribeAll(cli)
+
+	connectHooks.Lock()
+	fns := make([]func(), 0, len(connectHooks.m[cli]))
+	for fn := range connectHooks.m[cli] {
+		fns = append(fns, *fn)
+	}
+	connectHooks.Unlock()
+
+	for _, fn := range fns {
+		// paho calls the OnConnect handler in a goroutine, but fn may block with mqtt requests.
+		go fn()
+	}
+}
+
+// WatchConnection calls onReconnect every time the client becomes connected again after it was disconnected,
+// until ctx is done. The connection is notified by NotifyConnect if the client calls it, and is also polled
+// with the interval for clients which do not.
+func WatchConnection(ctx context.Context, cli mqtt.Client, interval time.Duration, onReconnect func()) {
+	var (
+		mu        sync.Mutex
+		connected = cli.IsConnectionOpen()
+	)
+	remove := OnConnect(cli, func() {
+		mu.Lock()
+		connected = true
+		mu.Unlock()
+		onReconnect()
+	})
+	defer remove()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			open := cli.IsConnectionOpen()
+			mu.Lock()
+			reconnected := open && !connected
+			connected = open
+			mu.Unlock()
+			if reconnected {
+				onReconnect()
+			}
+		}
+	}
+}
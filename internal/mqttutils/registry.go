@@ -0,0 +1,203 @@
+package mqttutils
+
+import (
+	"fmt"
+	"sync"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// subscriptions are the active subscriptions to be subscribed again on connect, keyed by the client and
+// the topic filter. paho keeps only one callback per topic filter, so each filter is subscribed once
+// with a callback which dispatches the messages to all the subscriptions registered for it.
+var subscriptions = struct {
+	// opMu serializes subscribing and unsubscribing, so that a filter is not unsubscribed by Close
+	// while it is subscribed again by Register.
+	opMu sync.Mutex
+
+	sync.Mutex
+	m map[mqtt.Client]map[string]*filter
+}{
+	m: make(map[mqtt.Client]map[string]*filter),
+}
+
+// filter is a topic filter subscribed by one or more subscriptions.
+type filter struct {
+	qos  int
+	subs map[*Subscription]struct{}
+}
+
+// Subscription is a long-lived subscription which is subscribed again every time the client is connected,
+// because the subscriptions are lost when the client reconnects with the clean session.
+// Several subscriptions of the same client can have the same topic filter; all of them receive the messages.
+type Subscription struct {
+	cli      mqtt.Client
+	topics   []string
+	callback mqtt.MessageHandler
+	errs     chan error
+}
+
+// Register subscribes topics and registers the subscription until Close is called.
+// The subscription is re-established by NotifyConnect. Topic filters already registered on the client are
+// not subscribed again, and keep the QoS of the first registration.
+func Register(cli mqtt.Client, topics []string, qos int, callback mqtt.MessageHandler) (*Subscription, error) {
+	sub := &Subscription{
+		cli:      cli,
+		topics:   topics,
+		callback: callback,
+		errs:     make(chan error, 1),
+	}
+
+	subscriptions.opMu.Lock()
+	defer subscriptions.opMu.Unlock()
+
+	subscriptions.Lock()
+	filters, ok := subscriptions.m[cli]
+	if !ok {
+		filters = make(map[string]*filter)
+		subscriptions.m[cli] = filters
+	}
+	var added []string
+	for _, topic := range topics {
+		f, ok := filters[topic]
+		if !ok {
+			f = &filter{qos: qos, subs: make(map[*Subscription]struct{})}
+			filters[topic] = f
+			added = append(added, topic)
+		}
+		f.subs[sub] = struct{}{}
+	}
+	subscriptions.Unlock()
+
+	filterQoS := make(map[string]int, len(added))
+	for _, topic := range added {
+		filterQoS[topic] = qos
+	}
+	var errs []error
+	for topic, err := range subscribeFilters(cli, filterQoS) {
+		errs = append(errs, fmt.Errorf("subscribe %s: %w", topic, err))
+	}
+	if len(errs) > 0 {
+		// the filters are unregistered so that the next Register subscribes them again.
+		// Unsubscribing them is best effort, because they may not be subscribed.
+		sub.close()
+		if len(errs) == 1 {
+			return nil, errs[0]
+		}
+		return nil, JoinErrors(errs...)
+	}
+	return sub, nil
+}
+
+// subscribeFilters subscribes each topic filter with its own dispatching callback,
+// and returns the errors of the filters which failed.
+func subscribeFilters(cli mqtt.Client, filterQoS map[string]int) map[string]error {
+	tokens := make(map[string]mqtt.Token, len(filterQoS))
+	for topic, qos := range filterQoS {
+		tokens[topic] = cli.Subscribe(topic, byte(qos), dispatcher(cli, topic))
+	}
+	errs := make(map[string]error)
+	for topic, token := range tokens {
+		token.Wait()
+		if err := token.Error(); err != nil {
+			errs[topic] = err
+		}
+	}
+	return errs
+}
+
+// dispatcher returns the paho callback of the topic filter, which calls the callbacks of all the
+// subscriptions registered for it.
+func dispatcher(cli mqtt.Client, topic string) mqtt.MessageHandler {
+	return func(mc mqtt.Client, msg mqtt.Message) {
+		subscriptions.Lock()
+		var callbacks []mqtt.MessageHandler
+		if f, ok := subscriptions.m[cli][topic]; ok {
+			callbacks = make([]mqtt.MessageHandler, 0, len(f.subs))
+			for sub := range f.subs {
+				callbacks = append(callbacks, sub.callback)
+			}
+		}
+		subscriptions.Unlock()
+
+		for _, callback := range callbacks {
+			callback(mc, msg)
+		}
+	}
+}
+
+// Err returns a channel which receives the error when re-establishing the subscription failed.
+// Only the first error is kept until it is received.
+func (sub *Subscription) Err() <-chan error {
+	return sub.errs
+}
+
+// Close unregisters the subscription. The topic filters which no other subscription uses are unsubscribed.
+func (sub *Subscription) Close() error {
+	subscriptions.opMu.Lock()
+	defer subscriptions.opMu.Unlock()
+	return sub.close()
+}
+
+// close is Close with opMu held.
+func (sub *Subscription) close() error {
+	subscriptions.Lock()
+	filters := subscriptions.m[sub.cli]
+	var removed []string
+	for _, topic := range sub.topics {
+		f, ok := filters[topic]
+		if !ok {
+			continue
+		}
+		if _, ok := f.subs[sub]; !ok {
+			continue
+		}
+		delete(f.subs, sub)
+		if len(f.subs) == 0 {
+			delete(filters, topic)
+			removed = append(removed, topic)
+		}
+	}
+	if len(filters) == 0 {
+		delete(subscriptions.m, sub.cli)
+	}
+	subscriptions.Unlock()
+
+	if len(removed) == 0 {
+		return nil
+	}
+	return Unsubscribe(sub.cli, removed)
+}
+
+func (sub *Subscription) notify(err error) {
+	select {
+	case sub.errs <- err:
+	default:
+	}
+}
+
+// resubscribeAll re-establishes all the registered topic filters of the client.
+// The error is sent to every subscription of the filter which failed.
+func resubscribeAll(cli mqtt.Client) {
+	subscriptions.opMu.Lock()
+	defer subscriptions.opMu.Unlock()
+
+	subscriptions.Lock()
+	qos := make(map[string]int, len(subscriptions.m[cli]))
+	for topic, f := range subscriptions.m[cli] {
+		qos[topic] = f.qos
+	}
+	subscriptions.Unlock()
+
+	errs := subscribeFilters(cli, qos)
+
+	subscriptions.Lock()
+	defer subscriptions.Unlock()
+	for topic, err := range errs {
+		if f, ok := subscriptions.m[cli][topic]; ok {
+			for sub := range f.subs {
+				sub.notify(fmt.Errorf("resubscribe %s: %w", topic, err))
+			}
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package mqttutils
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+type token struct {
+	err error
+}
+
+func (t *token) Wait() bool                     { return true }
+func (t *token) WaitTimeout(time.Duration) bool { return true }
+func (t *token) Done() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+func (t *token) Error() error { return t.err }
+
+// client is a fake mqtt.Client which keeps one route per topic filter like paho.
+type client struct {
+	mqtt.Client
+
+	mu           sync.Mutex
+	routes       map[string]mqtt.MessageHandler
+	subscribes   int
+	unsubscribed []string
+	subErr       error
+}
+
+func newClient() *client {
+	return &client{routes: make(map[string]mqtt.MessageHandler)}
+}
+
+func (c *client) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscribes++
+	if c.subErr != nil {
+		return &token{err: c.subErr}
+	}
+	c.routes[topic] = callback
+	return &token{}
+}
+
+func (c *client) Unsubscribe(topics ...string) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, topic := range topics {
+		delete(c.routes, topic)
+		c.unsubscribed = append(c.unsubscribed, topic)
+	}
+	return &token{}
+}
+
+// deliver calls the route of the filter, as paho does for a message matching it.
+func (c *client) deliver(filter string, topic string) bool {
+	c.mu.Lock()
+	route, ok := c.routes[filter]
+	c.mu.Unlock()
+	if ok {
+		route(c, &message{topic: topic})
+	}
+	return ok
+}
+
+type message struct {
+	mqtt.Message
+	topic string
+}
+
+func (m *message) Topic() string { return m.topic }
+
+func TestRegisterFanOut(t *testing.T) {
+	cli := newClient()
+	var got [2][]string
+	handler := func(i int) mqtt.MessageHandler {
+		return func(_ mqtt.Client, msg mqtt.Message) {
+			got[i] = append(got[i], msg.Topic())
+		}
+	}
+
+	a, err := Register(cli, []string{"shared", "a"}, 0, handler(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Register(cli, []string{"shared"}, 0, handler(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cli.subscribes != 2 {
+		t.Errorf("subscribed %d times, want once per filter", cli.subscribes)
+	}
+
+	cli.deliver("shared", "shared")
+	cli.deliver("a", "a")
+	if len(got[0]) != 2 || len(got[1]) != 1 {
+		t.Fatalf("got %v", got)
+	}
+
+	// the filter used by b is kept.
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(cli.unsubscribed) != 1 || cli.unsubscribed[0] != "a" {
+		t.Errorf("unsubscribed %v, want [a]", cli.unsubscribed)
+	}
+	if !cli.deliver("shared", "shared") || len(got[0]) != 2 || len(got[1]) != 2 {
+		t.Fatalf("got %v", got)
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(cli.unsubscribed) != 2 || cli.unsubscribed[1] != "shared" {
+		t.Errorf("unsubscribed %v, want [a shared]", cli.unsubscribed)
+	}
+	// closing again does nothing.
+	if err := b.Close(); err != nil || len(cli.unsubscribed) != 2 {
+		t.Errorf("second Close: %v, unsubscribed %v", err, cli.unsubscribed)
+	}
+
+	subscriptions.Lock()
+	_, ok := subscriptions.m[cli]
+	subscriptions.Unlock()
+	if ok {
+		t.Error("the client must be removed from the registry")
+	}
+}
+
+func TestResubscribeAll(t *testing.T) {
+	cli := newClient()
+	a, err := Register(cli, []string{"shared"}, 0, func(mqtt.Client, mqtt.Message) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := Register(cli, []string{"shared"}, 0, func(mqtt.Client, mqtt.Message) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	cli.subscribes = 0
+	resubscribeAll(cli)
+	if cli.subscribes != 1 {
+		t.Errorf("resubscribed %d times, want 1", cli.subscribes)
+	}
+
+	cli.subErr = errors.New("not connected")
+	resubscribeAll(cli)
+	for _, sub := range []*Subscription{a, b} {
+		select {
+		case err := <-sub.Err():
+			if !errors.Is(err, cli.subErr) {
+				t.Errorf("Err = %v", err)
+			}
+		default:
+			t.Error("the error must be sent to every subscription of the filter")
+		}
+	}
+}
+
+func TestRegisterError(t *testing.T) {
+	cli := newClient()
+	cli.subErr = errors.New("not connected")
+	if _, err := Register(cli, []string{"a"}, 0, func(mqtt.Client, mqtt.Message) {}); !errors.Is(err, cli.subErr) {
+		t.Fatalf("Register = %v", err)
+	}
+
+	// the failed filter is subscribed again by the next Register.
+	cli.subErr = nil
+	sub, err := Register(cli, []string{"a"}, 0, func(mqtt.Client, mqtt.Message) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	if _, ok := cli.routes["a"]; !ok {
+		t.Error("a must be subscribed")
+	}
+}
@@ -4,6 +4,8 @@
 package jobs
 
 import (
+	"encoding/json"
+
 	"github.com/aws/smithy-go/middleware"
 )
 
@@ -72,8 +74,11 @@ type JobExecution struct {
 	// can be used later in commands that return or update job execution information.
 	ExecutionNumber *int64 `json:"executionNumber"`
 
-	// The content of the job document.
-	JobDocument JobDocument `json:"jobDocument"`
+	// The content of the job document. It is empty if the job document does not match the schema.
+	JobDocument JobDocument `json:"-"`
+
+	// The job document as it was received. Use DecodeJobDocument to decode job documents of other schemas.
+	RawJobDocument json.RawMessage `json:"jobDocument,omitempty"`
 
 	// The unique identifier you assigned to this job when it was created.
 	JobId *string `json:"jobId"`
@@ -106,19 +111,36 @@ type JobExecution struct {
 	Timestamp   int    `json:"timestamp"`
 }
 
+// UnmarshalJSON keeps the raw job document, and decodes it into JobDocument if it matches the schema.
+// Otherwise JobDocument is empty and its Validate returns the decode error.
+func (j *JobExecution) UnmarshalJSON(b []byte) error {
+	type jobExecution JobExecution
+	if err := json.Unmarshal(b, (*jobExecution)(j)); err != nil {
+		return err
+	}
+	j.JobDocument = JobDocument{}
+	if len(j.RawJobDocument) > 0 {
+		if err := json.Unmarshal(j.RawJobDocument, &j.JobDocument); err != nil {
+			// custom schemas are available with RawJobDocument.
+			j.JobDocument = JobDocument{decodeErr: err}
+		}
+	}
+	return nil
+}
+
 // Contains data about the state of a job execution.
 type JobExecutionState struct {
 
 	// The status of the job execution. Can be one of: "QUEUED", "IN_PROGRESS",
 	// "FAILED", "SUCCESS", "CANCELED", "REJECTED", or "REMOVED".
-	Status JobExecutionStatus
+	Status JobExecutionStatus `json:"status"`
 
 	// A collection of name/value pairs that describe the status of the job execution.
-	StatusDetails map[string]string
+	StatusDetails map[string]string `json:"statusDetails"`
 
 	// The version of the job execution. Job execution versions are incremented each
 	// time they are updated by a device.
-	VersionNumber int64
+	VersionNumber int64 `json:"versionNumber"`
 }
 
 // Contains a subset of information about a job execution.
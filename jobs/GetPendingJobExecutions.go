@@ -0,0 +1,8 @@
+// These contents are copied and slightly modified from aws-sdk-go-v2
+// https://github.com/aws/aws-sdk-go-v2/tree/main/service/iotjobsdataplane
+// SPDX-License-Identifier: Apache-2.0
+package jobs
+
+type GetPendingJobExecutionsInput struct {
+	ClientToken string `json:"clientToken,omitempty"`
+}
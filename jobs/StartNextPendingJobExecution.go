@@ -5,6 +5,23 @@ package jobs
 
 import "github.com/aws/smithy-go/middleware"
 
+type StartNextPendingJobExecutionInput struct {
+
+	// Optional. A collection of name/value pairs that describe the status of the job
+	// execution. If not specified, the statusDetails are unchanged.
+	StatusDetails map[string]string `json:"statusDetails,omitempty"`
+
+	// Specifies the amount of time this device has to finish execution of this job. If
+	// the job execution status is not set to a terminal state before this timer
+	// expires, or before the timer is reset (by calling UpdateJobExecution, setting
+	// the status to IN_PROGRESS and specifying a new timeout value in field
+	// stepTimeoutInMinutes) the job execution status will be automatically set to
+	// TIMED_OUT.
+	StepTimeoutInMinutes *int64 `json:"stepTimeoutInMinutes,omitempty"`
+
+	ClientToken string `json:"clientToken,omitempty"`
+}
+
 type StartNextPendingJobExecutionOutput struct {
 
 	// A JobExecution object.
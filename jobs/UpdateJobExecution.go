@@ -14,7 +14,7 @@ type UpdateJobExecutionInput struct {
 
 	// Optional. A number that identifies a particular job execution on a particular
 	// device.
-	ExecutionNumber *int64 `json:"executionNumber"`
+	ExecutionNumber *int64 `json:"executionNumber,omitempty"`
 
 	// Optional. The expected current version of the job execution. Each time you
 	// update the job execution, its version is incremented. If the version of the job
@@ -23,19 +23,19 @@ type UpdateJobExecutionInput struct {
 	// execution status data is returned. (This makes it unnecessary to perform a
 	// separate DescribeJobExecution request in order to obtain the job execution
 	// status data.)
-	ExpectedVersion *int64 `json:"expectedVersion"`
+	ExpectedVersion *int64 `json:"expectedVersion,omitempty"`
 
 	// Optional. When set to true, the response contains the job document. The default
 	// is false.
-	IncludeJobDocument *bool `json:"includeJobDocument"`
+	IncludeJobDocument *bool `json:"includeJobDocument,omitempty"`
 
 	// Optional. When included and set to true, the response contains the
 	// JobExecutionState data. The default is false.
-	IncludeJobExecutionState *bool `json:"includeJobExecutionState"`
+	IncludeJobExecutionState *bool `json:"includeJobExecutionState,omitempty"`
 
 	// Optional. A collection of name/value pairs that describe the status of the job
 	// execution. If not specified, the statusDetails are unchanged.
-	StatusDetails map[string]string `json:"statusDetails"`
+	StatusDetails map[string]string `json:"statusDetails,omitempty"`
 
 	// Specifies the amount of time this device has to finish execution of this job. If
 	// the job execution status is not set to a terminal state before this timer
@@ -45,8 +45,8 @@ type UpdateJobExecutionInput struct {
 	// that setting or resetting this timeout has no effect on that job execution
 	// timeout which may have been specified when the job was created (CreateJob using
 	// field timeoutConfig).
-	StepTimeoutInMinutes *int64 `json:"stepTimeoutInMinutes"`
+	StepTimeoutInMinutes *int64 `json:"stepTimeoutInMinutes,omitempty"`
 
-	ClientToken string `json:"clientToken"`
-	Timestamp   int    `json:"timestamp"`
+	ClientToken string `json:"clientToken,omitempty"`
+	Timestamp   int    `json:"timestamp,omitempty"`
 }
@@ -0,0 +1,327 @@
+// SPDX-License-Identifier: Apache-2.0
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/iotjobsdataplane/types"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/shirou/aws-iot-device-lib/internal/mqttutils"
+)
+
+const (
+	defaultPollInterval    = 1 * time.Second
+	defaultRetryInterval   = 10 * time.Second
+	defaultShutdownTimeout = 10 * time.Second
+)
+
+// JobHandler runs the job execution. The returned status details are reported with SUCCEEDED,
+// or with FAILED if err is not nil, or with REJECTED if err is *ValidationError. ctx is canceled when ShutdownTimeout has passed after the agent is shut down.
+type JobHandler func(ctx context.Context, job *JobExecution) (statusDetails map[string]string, err error)
+
+// Agent runs the lifecycle of job executions of a thing: it listens to notify-next, starts the next pending
+// job execution, runs the handler of the job and reports the result. Job executions are run one at a time.
+type Agent struct {
+	client    *Client
+	thingName string
+
+	mu       sync.Mutex
+	handlers map[string]JobHandler
+
+	// OperationOf returns the operation of the job to choose the handler. The default returns JobDocument.Operation.
+	OperationOf func(job *JobExecution) string
+
+	// StepTimeout is set as stepTimeoutInMinutes when a job execution is started, and renewed while the handler
+	// is running so that long jobs do not time out. It is rounded up to minutes. 0 means no step timeout.
+	StepTimeout time.Duration
+
+	// InterruptedStatus is reported for the job execution whose handler was interrupted by shutdown.
+	// The default is FAILED. If IN_PROGRESS, the job execution is resumed by StartNextPendingJobExecution after restart.
+	InterruptedStatus JobExecutionStatus
+
+	// ShutdownTimeout is the time to wait for the handler to return and to report it after ctx of Run is done.
+	ShutdownTimeout time.Duration
+	// PollInterval is the interval to check whether the connection has been re-established.
+	PollInterval time.Duration
+	// RetryInterval is the interval to retry starting the next job execution, or reporting the result of
+	// the last one, when it failed.
+	RetryInterval time.Duration
+	// OnError is called when a request fails. Errors are discarded if nil.
+	OnError func(err error)
+
+	// unreported is the result of the last job execution which could not be reported. It is retried before
+	// starting the next job execution, so that the handler is not run again. It is only used by Run.
+	unreported *jobReport
+	// rejected has the errors of the job executions whose result was rejected, keyed by the job id.
+	// If such a job execution is started again, it is reported as FAILED without running the handler.
+	// It is only used by Run.
+	rejected map[string]error
+}
+
+// jobReport is the final status of a job execution to be reported.
+type jobReport struct {
+	jobId   string
+	status  JobExecutionStatus
+	details map[string]string
+}
+
+func NewAgent(client *Client, thingName string) (*Agent, error) {
+	if thingName == "" {
+		return nil, fmt.Errorf("thing name is required")
+	}
+	a := &Agent{
+		client:            client,
+		thingName:         thingName,
+		handlers:          make(map[string]JobHandler),
+		rejected:          make(map[string]error),
+		OperationOf:       func(job *JobExecution) string { return job.JobDocument.Operation },
+		InterruptedStatus: JobExecutionStatusFailed,
+		ShutdownTimeout:   defaultShutdownTimeout,
+		PollInterval:      defaultPollInterval,
+		RetryInterval:     defaultRetryInterval,
+	}
+
+	return a, nil
+}
+
+// Handle registers the handler of the operation. The handler of the empty operation is used for the jobs
+// whose operation has no handler. Jobs which have no handler are reported as REJECTED.
+func (a *Agent) Handle(operation string, handler JobHandler) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.handlers[operation] = handler
+}
+
+func (a *Agent) handler(operation string) (JobHandler, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if h, ok := a.handlers[operation]; ok {
+		return h, true
+	}
+	h, ok := a.handlers[""]
+	return h, ok
+}
+
+func (a *Agent) handleError(err error) {
+	if a.OnError != nil && err != nil {
+		a.OnError(err)
+	}
+}
+
+// stepTimeoutInMinutes returns the step timeout rounded up to minutes, or nil if it is not set.
+func stepTimeoutInMinutes(timeout time.Duration) *int64 {
+	if timeout <= 0 {
+		return nil
+	}
+	minutes := int64((timeout + time.Minute - 1) / time.Minute)
+	return &minutes
+}
+
+// Run runs pending job executions until ctx is done. Pending job executions are also checked at the start
+// and every time after the connection is re-established, because notifications may be lost while disconnected.
+// When ctx is done, the running handler is given ShutdownTimeout to finish before it is canceled,
+// and its job execution is reported before Run returns.
+func (a *Agent) Run(ctx context.Context) error {
+	mc := a.client.mc
+	topics := []string{fmt.Sprintf("$aws/things/%s/jobs/notify-next", a.thingName)}
+
+	wake := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+
+	sub, err := mqttutils.Register(mc, topics, 0, func(mc mqtt.Client, msg mqtt.Message) {
+		notify()
+	})
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	go mqttutils.WatchConnection(ctx, mc, a.PollInterval, notify)
+	notify()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.Err():
+			return err
+		case <-wake:
+			err := a.runPending(ctx)
+			if err != nil && (ctx.Err() == nil || !errors.Is(err, context.Canceled)) {
+				// the report of an interrupted job execution may fail after ctx is done.
+				a.handleError(err)
+				time.AfterFunc(a.RetryInterval, notify)
+			}
+		}
+	}
+}
+
+// runPending starts and runs the next pending job executions until there are none.
+// It stops when the result of a job execution could not be reported, and the report is retried first next time.
+func (a *Agent) runPending(ctx context.Context) error {
+	if a.unreported != nil {
+		if err := a.report(ctx, *a.unreported); err != nil {
+			return err
+		}
+	}
+	for ctx.Err() == nil {
+		ret, err := a.client.StartNextPendingJobExecution(ctx, a.thingName, StartNextPendingJobExecutionInput{
+			StepTimeoutInMinutes: stepTimeoutInMinutes(a.StepTimeout),
+		})
+		if err != nil {
+			return fmt.Errorf("start next pending job execution: %w", err)
+		}
+		if ret.Execution == nil || ret.Execution.JobId == nil {
+			return nil
+		}
+		if rejectedErr, ok := a.rejected[*ret.Execution.JobId]; ok {
+			err = a.report(ctx, jobReport{
+				jobId:   *ret.Execution.JobId,
+				status:  JobExecutionStatusFailed,
+				details: map[string]string{reasonKey: truncate(fmt.Sprintf("the result was rejected: %s", rejectedErr))},
+			})
+		} else {
+			err = a.runJob(ctx, ret.Execution)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runJob runs the handler of the job and reports the result. The error of the report is returned.
+func (a *Agent) runJob(ctx context.Context, job *JobExecution) error {
+	jobId := *job.JobId
+
+	handler, ok := a.handler(a.OperationOf(job))
+	if !ok {
+		return a.report(ctx, jobReport{
+			jobId:  jobId,
+			status: JobExecutionStatusRejected,
+			details: map[string]string{
+				reasonKey: fmt.Sprintf("no handler for operation %q", a.OperationOf(job)),
+			},
+		})
+	}
+
+	// the handler is not canceled until ctx is done and the ShutdownTimeout has passed.
+	jobCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-jobCtx.Done():
+		case <-ctx.Done():
+			timer := time.NewTimer(a.ShutdownTimeout)
+			defer timer.Stop()
+			select {
+			case <-jobCtx.Done():
+			case <-timer.C:
+				cancel()
+			}
+		}
+	}()
+
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		a.renewStepTimeout(jobCtx, jobId)
+	}()
+
+	details, err := handler(jobCtx, job)
+	cancel()
+	<-renewed
+
+	r := jobReport{jobId: jobId, status: JobExecutionStatusSucceeded, details: details}
+	var invalid *ValidationError
+	switch {
+	case err != nil && ctx.Err() != nil:
+		r.status = a.InterruptedStatus
+		err = fmt.Errorf("interrupted by shutdown: %w", err)
+	case errors.As(err, &invalid):
+		r.status = JobExecutionStatusRejected
+	case err != nil:
+		r.status = JobExecutionStatusFailed
+	}
+	if err != nil {
+		details := make(map[string]string, len(r.details)+1)
+		for k, v := range r.details {
+			details[k] = v
+		}
+		details[reasonKey] = truncate(err.Error())
+		r.details = details
+	}
+	// AWS IoT rejects the whole report if any of the details is invalid, and the job execution would stay
+	// IN_PROGRESS, so it is reported as FAILED without them.
+	if invalid := validateStatusDetails(r.details); invalid != nil {
+		r.status = JobExecutionStatusFailed
+		r.details = map[string]string{
+			reasonKey: truncate(fmt.Sprintf("invalid status details returned by the handler: %s", invalid)),
+		}
+	}
+	return a.report(ctx, r)
+}
+
+// renewStepTimeout resets the step timeout of the job execution periodically until ctx is done.
+func (a *Agent) renewStepTimeout(ctx context.Context, jobId string) {
+	timeout := stepTimeoutInMinutes(a.StepTimeout)
+	if timeout == nil {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(*timeout) * time.Minute / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			req := UpdateJobExecutionInput{
+				Status:               types.JobExecutionStatusInProgress,
+				StepTimeoutInMinutes: timeout,
+			}
+			if _, err := a.client.UpdateJobExecution(ctx, a.thingName, jobId, req); err != nil && ctx.Err() == nil {
+				a.handleError(fmt.Errorf("renew step timeout of %s: %w", jobId, err))
+			}
+		}
+	}
+}
+
+// report updates the status of the job execution. It is reported even after ctx is done, within ShutdownTimeout.
+// If it failed with a transient error, the report is kept to be retried by runPending.
+// Otherwise the report is dropped. Unless the job execution can not be updated anymore, e.g. it was canceled,
+// the job id is kept in rejected so that the handler is not run again when the job execution is started again.
+func (a *Agent) report(ctx context.Context, r jobReport) error {
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), a.ShutdownTimeout)
+		defer cancel()
+	}
+	req := UpdateJobExecutionInput{
+		Status:        types.JobExecutionStatus(r.status),
+		StatusDetails: r.details,
+	}
+	a.unreported = nil
+	if _, err := a.client.UpdateJobExecution(ctx, a.thingName, r.jobId, req); err != nil {
+		switch {
+		case IsRetryable(err):
+			a.unreported = &r
+		case errors.Is(err, ErrTerminalStateReached) || errors.Is(err, ErrInvalidStateTransition) || errors.Is(err, ErrResourceNotFound):
+			delete(a.rejected, r.jobId)
+		default:
+			a.rejected[r.jobId] = err
+		}
+		return fmt.Errorf("report %s of %s: %w", r.status, r.jobId, err)
+	}
+	delete(a.rejected, r.jobId)
+	return nil
+}
@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: Apache-2.0
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// jobQueue answers start-next with the job until its terminal status is accepted,
+// and rejects or drops the updates with the results of reject.
+type jobQueue struct {
+	mu      sync.Mutex
+	done    bool
+	updates int
+	// reject returns the error code for the n-th update (from 1), "" to accept,
+	// or "timeout" not to answer.
+	reject func(n int) string
+}
+
+func (q *jobQueue) respond(topic string, req map[string]any) (string, map[string]any) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	switch {
+	case strings.HasSuffix(topic, "/start-next"):
+		if q.done {
+			return "accepted", nil
+		}
+		return "accepted", map[string]any{
+			"execution": map[string]any{"jobId": "job1", "status": "IN_PROGRESS", "jobDocument": map[string]any{}},
+		}
+	case strings.HasSuffix(topic, "/update"):
+		q.updates++
+		code := ""
+		if q.reject != nil {
+			code = q.reject(q.updates)
+		}
+		switch code {
+		case "":
+			if status := req["status"]; status != "IN_PROGRESS" {
+				q.done = true
+			}
+			return "accepted", nil
+		case "timeout":
+			return "", nil
+		default:
+			return "rejected", map[string]any{"code": code, "message": "rejected"}
+		}
+	}
+	return "accepted", nil
+}
+
+func newTestAgent(t *testing.T, q *jobQueue, handler JobHandler) (*Agent, *broker, *int) {
+	t.Helper()
+	b := newBroker()
+	b.respond = q.respond
+	client, _ := NewClient(b)
+	t.Cleanup(func() { client.Close() })
+	client.SetTimeout(50 * time.Millisecond)
+
+	a, err := NewAgent(client, "thing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := 0
+	a.Handle("", func(ctx context.Context, job *JobExecution) (map[string]string, error) {
+		runs++
+		return handler(ctx, job)
+	})
+	return a, b, &runs
+}
+
+func TestAgentInvalidStatusDetails(t *testing.T) {
+	q := &jobQueue{}
+	a, b, runs := newTestAgent(t, q, func(ctx context.Context, job *JobExecution) (map[string]string, error) {
+		return map[string]string{"output": "line 1\nline 2"}, nil
+	})
+
+	if err := a.runPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if *runs != 1 {
+		t.Errorf("handler ran %d times", *runs)
+	}
+	updates := b.requests("/update")
+	if len(updates) != 1 {
+		t.Fatalf("updated %d times", len(updates))
+	}
+	if updates[0]["status"] != "FAILED" {
+		t.Errorf("status = %v", updates[0]["status"])
+	}
+	details := updates[0]["statusDetails"].(map[string]any)
+	if _, ok := details["output"]; ok || !strings.Contains(details[reasonKey].(string), "invalid status details") {
+		t.Errorf("statusDetails = %v", details)
+	}
+}
+
+func TestAgentTooManyStatusDetails(t *testing.T) {
+	q := &jobQueue{}
+	a, b, _ := newTestAgent(t, q, func(ctx context.Context, job *JobExecution) (map[string]string, error) {
+		details := map[string]string{}
+		for _, k := range strings.Split("a,b,c,d,e,f,g,h,i,j", ",") {
+			details[k] = "v"
+		}
+		// reason makes 11 details.
+		return details, errors.New("failed")
+	})
+
+	if err := a.runPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	updates := b.requests("/update")
+	if len(updates) != 1 || updates[0]["status"] != "FAILED" || len(updates[0]["statusDetails"].(map[string]any)) != 1 {
+		t.Errorf("updates = %v", updates)
+	}
+}
+
+func TestAgentRejectedReport(t *testing.T) {
+	q := &jobQueue{reject: func(n int) string {
+		if n == 1 {
+			return string(ErrorCodeInvalidRequest)
+		}
+		return ""
+	}}
+	a, b, runs := newTestAgent(t, q, func(ctx context.Context, job *JobExecution) (map[string]string, error) {
+		return map[string]string{"result": "ok"}, nil
+	})
+
+	if err := a.runPending(context.Background()); err == nil {
+		t.Fatal("the rejected report must be returned")
+	}
+	// the job execution is started again, but the handler is not run.
+	if err := a.runPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if *runs != 1 {
+		t.Errorf("handler ran %d times", *runs)
+	}
+	updates := b.requests("/update")
+	if len(updates) != 2 || updates[1]["status"] != "FAILED" {
+		t.Fatalf("updates = %v", updates)
+	}
+	if len(a.rejected) != 0 {
+		t.Errorf("rejected = %v", a.rejected)
+	}
+}
+
+func TestAgentRetryReport(t *testing.T) {
+	q := &jobQueue{reject: func(n int) string {
+		if n == 1 {
+			return "timeout"
+		}
+		return ""
+	}}
+	a, b, runs := newTestAgent(t, q, func(ctx context.Context, job *JobExecution) (map[string]string, error) {
+		return map[string]string{"result": "ok"}, nil
+	})
+
+	if err := a.runPending(context.Background()); err == nil {
+		t.Fatal("the failed report must be returned")
+	}
+	if a.unreported == nil {
+		t.Fatal("the report must be kept")
+	}
+	if err := a.runPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if *runs != 1 {
+		t.Errorf("handler ran %d times", *runs)
+	}
+	updates := b.requests("/update")
+	if len(updates) != 2 || updates[1]["status"] != "SUCCEEDED" {
+		t.Fatalf("updates = %v", updates)
+	}
+}
@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: Apache-2.0
+package jobs
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+type token struct{}
+
+func (t *token) Wait() bool                     { return true }
+func (t *token) WaitTimeout(time.Duration) bool { return true }
+func (t *token) Done() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+func (t *token) Error() error { return nil }
+
+// published is a message published by the client.
+type published struct {
+	topic   string
+	payload []byte
+	at      time.Time
+}
+
+// broker is a fake mqtt.Client which answers the requests with respond.
+type broker struct {
+	mqtt.Client
+
+	mu        sync.Mutex
+	routes    map[string]mqtt.MessageHandler
+	published []published
+
+	// respond returns the suffix of the response topic, "accepted" or "rejected", and the payload
+	// for the request. The request is not answered if the suffix is empty.
+	// The default accepts every request with its clientToken.
+	respond func(topic string, req map[string]any) (string, map[string]any)
+}
+
+func newBroker() *broker {
+	return &broker{routes: make(map[string]mqtt.MessageHandler)}
+}
+
+func (b *broker) IsConnectionOpen() bool { return true }
+
+func (b *broker) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.routes[topic] = callback
+	return &token{}
+}
+
+func (b *broker) Unsubscribe(topics ...string) mqtt.Token {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, topic := range topics {
+		delete(b.routes, topic)
+	}
+	return &token{}
+}
+
+func (b *broker) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	data := payload.([]byte)
+	b.mu.Lock()
+	b.published = append(b.published, published{topic: topic, payload: data, at: time.Now()})
+	respond := b.respond
+	b.mu.Unlock()
+
+	var req map[string]any
+	json.Unmarshal(data, &req)
+	suffix, res := "accepted", map[string]any{}
+	if respond != nil {
+		suffix, res = respond(topic, req)
+	}
+	if suffix == "" {
+		return &token{}
+	}
+	if res == nil {
+		res = map[string]any{}
+	}
+	res["clientToken"] = req["clientToken"]
+	go b.deliver(topic+"/"+suffix, res)
+	return &token{}
+}
+
+// deliver calls the routes which match the topic.
+func (b *broker) deliver(topic string, payload any) {
+	data, _ := json.Marshal(payload)
+	b.mu.Lock()
+	var routes []mqtt.MessageHandler
+	for filter, route := range b.routes {
+		if match(filter, topic) {
+			routes = append(routes, route)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, route := range routes {
+		route(b, &message{topic: topic, payload: data})
+	}
+}
+
+// requests returns the payloads published to the topics which have the suffix.
+func (b *broker) requests(suffix string) []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var ret []map[string]any
+	for _, p := range b.published {
+		if strings.HasSuffix(p.topic, suffix) {
+			var req map[string]any
+			json.Unmarshal(p.payload, &req)
+			ret = append(ret, req)
+		}
+	}
+	return ret
+}
+
+// match reports whether the topic matches the filter with + and # wildcards.
+func match(filter string, topic string) bool {
+	fs, ts := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if i >= len(ts) || (f != "+" && f != ts[i]) {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
@@ -17,7 +17,9 @@ type changedMessageType interface {
 	JobExecutionsChangedMessage | NextJobExecutionChangedMessage
 }
 
-func handleChanged[K changedHandlerType[V], V changedMessageType](ctx context.Context, client *Client, topics []string, handler K) {
+// handleChanged subscribes topics and calls handler on every message until ctx is done.
+// The subscription is re-established on reconnect. If it failed, the error is returned.
+func handleChanged[K changedHandlerType[V], V changedMessageType](ctx context.Context, client *Client, topics []string, handler K) error {
 	callback := func(mc mqtt.Client, msg mqtt.Message) {
 		var je V
 		if err := json.Unmarshal(msg.Payload(), &je); err != nil {
@@ -26,36 +28,36 @@ func handleChanged[K changedHandlerType[V], V changedMessageType](ctx context.Co
 		}
 		go handler(client, je)
 	}
-	if err := mqttutils.Subscribe(client.mc, topics, 0, callback); err != nil {
-		return
+	sub, err := mqttutils.Register(client.mc, topics, 0, callback)
+	if err != nil {
+		return err
 	}
-	defer func() {
-		mqttutils.Unsubscribe(client.mc, topics)
-	}()
-
-	// forever
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		}
+	defer sub.Close()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-sub.Err():
+		return err
 	}
 }
 
 type JobExecutionsChangedHandler func(cli *Client, msg JobExecutionsChangedMessage) error
 
 // JobExecutionsChanged sent whenever a job execution is added to or removed from the list of pending job executions for a thing.
-func (client *Client) JobExecutionsChanged(ctx context.Context, thingName string, handler JobExecutionsChangedHandler) {
+// It blocks until ctx is done, or returns the error when the subscription can not be re-established after reconnect.
+func (client *Client) JobExecutionsChanged(ctx context.Context, thingName string, handler JobExecutionsChangedHandler) error {
 	topics := []string{fmt.Sprintf("$aws/things/%s/jobs/notify", thingName)}
 
-	handleChanged(ctx, client, topics, handler)
+	return handleChanged(ctx, client, topics, handler)
 }
 
 type NextJobExecutionChangedHandler func(cli *Client, msg NextJobExecutionChangedMessage) error
 
-// NextJobExecutionChanged sent whenever there is a change to which job execution is next on the list of pending job executions for a thing
-func (client *Client) NextJobExecutionChanged(ctx context.Context, thingName string, handler NextJobExecutionChangedHandler) {
+// NextJobExecutionChanged sent whenever there is a change to which job execution is next on the list of pending job executions for a thing.
+// It blocks until ctx is done, or returns the error when the subscription can not be re-established after reconnect.
+func (client *Client) NextJobExecutionChanged(ctx context.Context, thingName string, handler NextJobExecutionChangedHandler) error {
 	topics := []string{fmt.Sprintf("$aws/things/%s/jobs/notify-next", thingName)}
 
-	handleChanged(ctx, client, topics, handler)
+	return handleChanged(ctx, client, topics, handler)
 }
@@ -6,10 +6,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/iotjobsdataplane"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
 	"github.com/shirou/aws-iot-device-lib/internal/mqttutils"
 )
 
@@ -17,6 +19,9 @@ const defaultTimeout = 1 * time.Second
 
 type Client struct {
 	mc       mqtt.Client
+	router   *router
+	release  sync.Once
+	retry    RetryPolicy
 	Timeouts time.Duration
 }
 
@@ -25,6 +30,7 @@ func NewClient(mc mqtt.Client) (*Client, error) {
 		mc:       mc,
 		Timeouts: defaultTimeout,
 	}
+	client.router = acquireRouter(mc)
 
 	return client, nil
 }
@@ -35,6 +41,21 @@ func (client *Client) SetTimeout(dur time.Duration) {
 	client.Timeouts = dur
 }
 
+// SetRetryPolicy sets the retry policy of the requests. The default is no retries.
+// The timeout set by SetTimeout applies to each attempt.
+func (client *Client) SetRetryPolicy(p RetryPolicy) {
+	client.retry = p
+}
+
+// Close releases the response topics subscribed by the requests. They are unsubscribed when every Client
+// of the mqtt.Client is closed. The Client must not be used after Close.
+func (client *Client) Close() (err error) {
+	client.release.Do(func() {
+		err = client.router.release()
+	})
+	return err
+}
+
 type outputType interface {
 	DescribeJobExecutionOutput |
 		iotjobsdataplane.GetPendingJobExecutionsOutput |
@@ -42,123 +63,88 @@ type outputType interface {
 		StartNextPendingJobExecutionOutput
 }
 
-// handleAsync is a generic processing function. It is not recommended to use this function from outside of this "jobs" package. It may be moved under "internal" in the future.
-func handleAsync[K outputType](ctx context.Context, mc mqtt.Client, payload []byte, subTopics []string, pubTopic string) (ret K, err error) {
-	accepted := make(chan K)
-	rejected := make(chan error)
-	callback := func(mc mqtt.Client, msg mqtt.Message) {
-		if err := IsError(msg.Payload()); err != nil {
-			rejected <- err
-			return
-		}
-		var output K
-		if err = json.Unmarshal(msg.Payload(), &output); err != nil {
-			rejected <- err
-			return
-		}
-
-		if strings.HasSuffix(msg.Topic(), "accepted") {
-			accepted <- output
-		} else if strings.HasSuffix(msg.Topic(), "rejected") {
-			rejected <- fmt.Errorf("rejected") // TODO: what payload if rejected?
-		} else {
-			rejected <- fmt.Errorf("unknown topic subscribed, %s", msg.Topic())
-			return
-		}
+// newClientToken returns clientToken if it is given, or generates a new one.
+func newClientToken(clientToken string) string {
+	if clientToken != "" {
+		return clientToken
 	}
+	return uuid.NewString()
+}
 
-	if err = mqttutils.Subscribe(mc, subTopics, 0, callback); err != nil {
+// request publishes req to pubTopic and waits for the response dispatched by the router, with the retry policy.
+// The response is matched strictly by the topic and clientToken, so req must have clientToken.
+func request[K outputType](ctx context.Context, client *Client, thingName string, pubTopic string, clientToken string, req any) (ret K, err error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
 		return
 	}
-	defer func() {
-		close(accepted)
-		close(rejected)
-		err = mqttutils.JoinErrors(err, mqttutils.Unsubscribe(mc, subTopics))
-	}()
+	return retry(ctx, client.retry, func() (K, error) {
+		return attempt[K](ctx, client, thingName, pubTopic, clientToken, payload)
+	})
+}
+
+// attempt publishes the payload once and waits for the response until the timeout.
+func attempt[K outputType](ctx context.Context, client *Client, thingName string, pubTopic string, clientToken string, payload []byte) (ret K, err error) {
+	if err = client.router.subscribe(thingName); err != nil {
+		return ret, &PublishError{Err: err}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, client.Timeouts)
+	defer cancel()
 
-	if err = mqttutils.Publish(mc, pubTopic, 0, payload); err != nil {
+	ch, done, err := client.router.wait(routeKey{pubTopic: pubTopic, clientToken: clientToken})
+	if err != nil {
 		return
 	}
-	for {
-		select {
-		case r := <-accepted:
-			return r, nil
-		case err = <-rejected:
-			return ret, err
-		case <-ctx.Done():
-			return ret, ctx.Err()
+	defer done()
+
+	if err = mqttutils.Publish(client.mc, pubTopic, 0, payload); err != nil {
+		return ret, &PublishError{Err: err}
+	}
+
+	select {
+	case res := <-ch:
+		if err = IsError(res.payload); err != nil {
+			return
 		}
+		if strings.HasSuffix(res.topic, "/rejected") {
+			return ret, fmt.Errorf("rejected")
+		}
+		err = json.Unmarshal(res.payload, &ret)
+		return
+	case <-ctx.Done():
+		return ret, ctx.Err()
 	}
 }
 
 // GetPendingJobExecutions gets detailed information about a job execution.
-func (client *Client) GetPendingJobExecutions(ctx context.Context, thingName string, req iotjobsdataplane.GetPendingJobExecutionsInput) (ret iotjobsdataplane.GetPendingJobExecutionsOutput, err error) {
-	topics := []string{
-		fmt.Sprintf("$aws/things/%s/jobs/get/accepted", thingName),
-		fmt.Sprintf("$aws/things/%s/jobs/get/rejected", thingName),
-	}
+func (client *Client) GetPendingJobExecutions(ctx context.Context, thingName string, req GetPendingJobExecutionsInput) (ret iotjobsdataplane.GetPendingJobExecutionsOutput, err error) {
 	pubTopic := fmt.Sprintf("$aws/things/%s/jobs/get", thingName)
 
-	payload, err := json.Marshal(req)
-	if err != nil {
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(ctx, client.Timeouts)
-	defer cancel()
-	return handleAsync[iotjobsdataplane.GetPendingJobExecutionsOutput](ctx, client.mc, payload, topics, pubTopic)
+	req.ClientToken = newClientToken(req.ClientToken)
+	return request[iotjobsdataplane.GetPendingJobExecutionsOutput](ctx, client, thingName, pubTopic, req.ClientToken, req)
 }
 
 // StartNextPendingJobExecution gets and starts the next pending job execution for a thing
-func (client *Client) StartNextPendingJobExecution(ctx context.Context, thingName string, req iotjobsdataplane.StartNextPendingJobExecutionInput) (ret StartNextPendingJobExecutionOutput, err error) {
-	topics := []string{
-		fmt.Sprintf("$aws/things/%s/jobs/start-next/accepted", thingName),
-		fmt.Sprintf("$aws/things/%s/jobs/start-next/rejected", thingName),
-	}
+func (client *Client) StartNextPendingJobExecution(ctx context.Context, thingName string, req StartNextPendingJobExecutionInput) (ret StartNextPendingJobExecutionOutput, err error) {
 	pubTopic := fmt.Sprintf("$aws/things/%s/jobs/start-next", thingName)
 
-	payload, err := json.Marshal(req)
-	if err != nil {
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(ctx, client.Timeouts)
-	defer cancel()
-	return handleAsync[StartNextPendingJobExecutionOutput](ctx, client.mc, payload, topics, pubTopic)
+	req.ClientToken = newClientToken(req.ClientToken)
+	return request[StartNextPendingJobExecutionOutput](ctx, client, thingName, pubTopic, req.ClientToken, req)
 }
 
 // DescribeJobExecution gets detailed information about a job execution.
 func (client *Client) DescribeJobExecution(ctx context.Context, thingName string, jobId string, req DescribeJobExecutionInput) (ret DescribeJobExecutionOutput, err error) {
-	topics := []string{
-		fmt.Sprintf("$aws/things/%s/jobs/%s/get/accepted", thingName, jobId),
-		fmt.Sprintf("$aws/things/%s/jobs/%s/get/rejected", thingName, jobId),
-	}
 	pubTopic := fmt.Sprintf("$aws/things/%s/jobs/%s/get", thingName, jobId)
 
-	payload, err := json.Marshal(req)
-	if err != nil {
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(ctx, client.Timeouts)
-	defer cancel()
-	return handleAsync[DescribeJobExecutionOutput](ctx, client.mc, payload, topics, pubTopic)
+	req.ClientToken = newClientToken(req.ClientToken)
+	return request[DescribeJobExecutionOutput](ctx, client, thingName, pubTopic, req.ClientToken, req)
 }
 
 // UpdateJobExecution updates the status of a job execution.
 func (client *Client) UpdateJobExecution(ctx context.Context, thingName string, jobId string, req UpdateJobExecutionInput) (ret iotjobsdataplane.UpdateJobExecutionOutput, err error) {
-	topics := []string{
-		fmt.Sprintf("$aws/things/%s/jobs/%s/update/accepted", thingName, jobId),
-		fmt.Sprintf("$aws/things/%s/jobs/%s/update/rejected", thingName, jobId),
-	}
 	pubTopic := fmt.Sprintf("$aws/things/%s/jobs/%s/update", thingName, jobId)
 
-	payload, err := json.Marshal(req)
-	if err != nil {
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(ctx, client.Timeouts)
-	defer cancel()
-	return handleAsync[iotjobsdataplane.UpdateJobExecutionOutput](ctx, client.mc, payload, topics, pubTopic)
+	req.ClientToken = newClientToken(req.ClientToken)
+	return request[iotjobsdataplane.UpdateJobExecutionOutput](ctx, client, thingName, pubTopic, req.ClientToken, req)
 }
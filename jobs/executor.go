@@ -0,0 +1,290 @@
+// SPDX-License-Identifier: Apache-2.0
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// defaultHandlerPath is the path of the action which means the handler directory of the executor.
+	defaultHandlerPath = "default"
+
+	// maxOutputSize is the size of the tail of stdout and stderr kept for each step.
+	maxOutputSize = 1024
+)
+
+// StepResult is the result of a step of the job document.
+type StepResult struct {
+	Name     string
+	ExitCode int
+	// Stdout and Stderr are the tails of the output, up to 1024 bytes. Control and format characters, such as
+	// newlines and BOM, are replaced with spaces, because they are not allowed in statusDetails.
+	Stdout   string
+	Stderr   string
+	Duration time.Duration
+	Err      error
+}
+
+// ExecutionResult is the result of the steps and the final step of the job document.
+type ExecutionResult struct {
+	Steps     []StepResult
+	FinalStep *StepResult
+}
+
+// Err returns the error of the first failed step, or of the final step.
+func (r *ExecutionResult) Err() error {
+	for _, s := range r.Steps {
+		if s.Err != nil {
+			return fmt.Errorf("step %s: %w", s.Name, s.Err)
+		}
+	}
+	if r.FinalStep != nil && r.FinalStep.Err != nil {
+		return fmt.Errorf("final step %s: %w", r.FinalStep.Name, r.FinalStep.Err)
+	}
+	return nil
+}
+
+// StatusDetails returns the summary of the result to be reported as statusDetails of the job execution.
+// The output of the failed step, or of the last step if all succeeded, is included.
+// The final step is included only when it failed and the steps did not.
+func (r *ExecutionResult) StatusDetails() map[string]string {
+	details := map[string]string{
+		"steps": strconv.Itoa(len(r.Steps)),
+	}
+	var last *StepResult
+	for i := range r.Steps {
+		last = &r.Steps[i]
+		if last.Err != nil {
+			break
+		}
+	}
+	if err := r.Err(); err != nil {
+		details[reasonKey] = truncate(err.Error())
+	}
+	if (last == nil || last.Err == nil) && r.FinalStep != nil && r.FinalStep.Err != nil {
+		last = r.FinalStep
+	}
+	if last == nil {
+		return details
+	}
+	details["step"] = truncate(last.Name)
+	details["exitCode"] = strconv.Itoa(last.ExitCode)
+	if last.Stdout != "" {
+		details["stdout"] = last.Stdout
+	}
+	if last.Stderr != "" {
+		details["stderr"] = last.Stderr
+	}
+	return details
+}
+
+// Executor runs the steps of the job document like aws-iot-device-client does.
+// Both runHandler and runCommand actions are supported.
+// https://github.com/awslabs/aws-iot-device-client/tree/main/sample-job-docs
+type Executor struct {
+	// HandlerDir is the directory of the handler scripts, used when path of the action is empty or "default".
+	HandlerDir string
+
+	// StepTimeout is the timeout of each step. 0 means no timeout.
+	StepTimeout time.Duration
+}
+
+func NewExecutor(handlerDir string) (*Executor, error) {
+	if handlerDir == "" {
+		return nil, fmt.Errorf("handler directory is required")
+	}
+	e := &Executor{
+		HandlerDir: handlerDir,
+	}
+
+	return e, nil
+}
+
+// Run runs the steps in order until one fails, and then always runs the final step, even if ctx is done.
+// The returned error is the same as ExecutionResult.Err.
+func (e *Executor) Run(ctx context.Context, doc JobDocument) (*ExecutionResult, error) {
+	ret := &ExecutionResult{}
+	for _, step := range doc.Steps {
+		result := e.runStep(ctx, step.Action)
+		ret.Steps = append(ret.Steps, result)
+		if result.Err != nil {
+			break
+		}
+	}
+
+	if doc.FinalStep != nil {
+		// the final step is for cleanup, so it is run even after ctx is done.
+		result := e.runStep(context.Background(), doc.FinalStep.Action)
+		ret.FinalStep = &result
+	}
+	return ret, ret.Err()
+}
+
+// JobHandler returns the JobHandler for Agent which validates and runs the job document of the job.
+// Invalid job documents are not run, and are reported as REJECTED by Agent.
+func (e *Executor) JobHandler() JobHandler {
+	return func(ctx context.Context, job *JobExecution) (map[string]string, error) {
+		if err := job.JobDocument.Validate(); err != nil {
+			return nil, err
+		}
+		ret, err := e.Run(ctx, job.JobDocument)
+		return ret.StatusDetails(), err
+	}
+}
+
+// handlerPath returns the path of the handler script. The handler must be in the directory.
+func (e *Executor) handlerPath(a Action) (string, error) {
+	dir := a.Input.Path
+	if dir == "" || dir == defaultHandlerPath {
+		dir = e.HandlerDir
+	}
+	if a.Input.Handler == "" {
+		return "", fmt.Errorf("handler is not specified")
+	}
+	if filepath.Base(a.Input.Handler) != a.Input.Handler || a.Input.Handler == ".." {
+		return "", fmt.Errorf("handler must be a file name: %s", a.Input.Handler)
+	}
+	return filepath.Join(dir, a.Input.Handler), nil
+}
+
+// command returns the command line of the action.
+// As aws-iot-device-client does, the handler of runHandler receives runAsUser as the first argument, followed by args,
+// and is responsible for switching the user, e.g. with sudo. The command of runCommand is run with sudo if runAsUser is set.
+func (e *Executor) command(a Action) ([]string, error) {
+	switch a.Type {
+	case ActionTypeRunHandler:
+		path, err := e.handlerPath(a)
+		if err != nil {
+			return nil, err
+		}
+		return append([]string{path, a.RunAsUser}, a.Input.Args...), nil
+	case ActionTypeRunCommand:
+		args := splitCommand(a.Input.Command)
+		if len(args) == 0 {
+			return nil, fmt.Errorf("command is not specified")
+		}
+		if a.RunAsUser != "" {
+			args = append([]string{"sudo", "-u", a.RunAsUser, "-n"}, args...)
+		}
+		return args, nil
+	default:
+		return nil, fmt.Errorf("unsupported action type: %s", a.Type)
+	}
+}
+
+// splitCommand splits the command of runCommand by commas. A comma escaped with a backslash is kept.
+func splitCommand(command string) []string {
+	var (
+		args []string
+		cur  strings.Builder
+	)
+	for i := 0; i < len(command); i++ {
+		switch {
+		case command[i] == '\\' && i+1 < len(command) && command[i+1] == ',':
+			cur.WriteByte(',')
+			i++
+		case command[i] == ',':
+			args = append(args, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		default:
+			cur.WriteByte(command[i])
+		}
+	}
+	if last := strings.TrimSpace(cur.String()); last != "" || len(args) > 0 {
+		args = append(args, last)
+	}
+	return args
+}
+
+// runStep runs the action with the step timeout.
+func (e *Executor) runStep(ctx context.Context, a Action) (ret StepResult) {
+	ret.Name = a.Name
+	ret.ExitCode = -1
+	start := time.Now()
+	defer func() {
+		ret.Duration = time.Since(start)
+	}()
+
+	args, err := e.command(a)
+	if err != nil {
+		ret.Err = err
+		return
+	}
+	path := args[0]
+
+	if e.StepTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.StepTimeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, path, args[1:]...)
+	stdout := &tailBuffer{max: maxOutputSize}
+	stderr := &tailBuffer{max: maxOutputSize}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err = cmd.Run()
+	ret.Stdout = stdout.String()
+	ret.Stderr = stderr.String()
+	ret.ExitCode = cmd.ProcessState.ExitCode()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err != nil && ctx.Err() != nil:
+		ret.Err = fmt.Errorf("%s: %w", path, ctx.Err())
+	case errors.As(err, &exitErr):
+		ret.Err = fmt.Errorf("%s exited with %d", path, exitErr.ExitCode())
+	case err != nil:
+		ret.Err = err
+	}
+	return
+}
+
+// tailBuffer keeps the last max bytes written. String returns them as a value of statusDetails.
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = b.buf[len(b.buf)-b.max:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	return truncate(string(b.buf))
+}
+
+// truncate returns the tail of s which fits in a value of statusDetails.
+// Characters of the Unicode category C (control, format such as BOM or U+200B, private use) and invalid UTF-8,
+// including a rune split by tailBuffer, are replaced with spaces, because statusDetails does not accept them,
+// and s is cut on a rune boundary.
+func truncate(s string) string {
+	s = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || unicode.Is(unicode.C, r) {
+			return ' '
+		}
+		return r
+	}, s))
+	if len(s) <= maxOutputSize {
+		return s
+	}
+	i := len(s) - maxOutputSize
+	for !utf8.RuneStart(s[i]) {
+		i++
+	}
+	return s[i:]
+}
@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: Apache-2.0
+package jobs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+// checkStatusDetails fails if the details exceed the limits of statusDetails.
+func checkStatusDetails(t *testing.T, details map[string]string) {
+	t.Helper()
+	if len(details) > maxStatusDetails {
+		t.Errorf("too many details: %d", len(details))
+	}
+	for k, v := range details {
+		if v == "" || len(v) > maxStatusDetailSize {
+			t.Errorf("%s: invalid size %d", k, len(v))
+		}
+		if !utf8.ValidString(v) {
+			t.Errorf("%s: invalid UTF-8 %q", k, v)
+		}
+		if strings.IndexFunc(v, func(r rune) bool { return unicode.Is(unicode.C, r) }) >= 0 {
+			t.Errorf("%s: character of category C in %q", k, v)
+		}
+	}
+}
+
+func TestExecutorMultiLineOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("handler is a shell script")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"printf '\\357\\273\\277line 1\\n'\n" + // with BOM
+		"printf 'line 2\\r\\n\\tline 3\\n'\n" +
+		"echo \"error 1\" >&2\n" +
+		"echo \"error 2\" >&2\n" +
+		"exit 3\n"
+	if err := os.WriteFile(filepath.Join(dir, "fail.sh"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewExecutor(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ret, err := e.Run(context.Background(), JobDocument{
+		Version: "1.0",
+		Steps: []Step{
+			{Action: Action{Name: "fail", Type: ActionTypeRunHandler, Input: ActionInput{Handler: "fail.sh"}}},
+		},
+	})
+	if err == nil {
+		t.Fatal("the step must fail")
+	}
+
+	details := ret.StatusDetails()
+	checkStatusDetails(t, details)
+	if got, want := details["stdout"], "line 1 line 2   line 3"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	if got, want := details["stderr"], "error 1 error 2"; got != want {
+		t.Errorf("stderr = %q, want %q", got, want)
+	}
+	if got := details["exitCode"]; got != "3" {
+		t.Errorf("exitCode = %q", got)
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{max: maxOutputSize}
+	// the head is cut in the middle of a rune.
+	b.Write([]byte("a"))
+	b.Write([]byte(strings.Repeat("あ\n", maxOutputSize/4)))
+
+	s := b.String()
+	checkStatusDetails(t, map[string]string{"stdout": s})
+	if !strings.HasPrefix(s, "あ") || !strings.HasSuffix(s, "あ") {
+		t.Errorf("got %q", s)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"short", "error", "error"},
+		{"control characters", "a\nb\tc\x00d\x7f", "a b c d"},
+		{"trimmed", "\n  error\n", "error"},
+		{"invalid UTF-8", "a\xffb", "a b"},
+		{"format characters", "\ufeffa\u200bb\u200dc\u00add", "a b c d"},
+		{"private use", "a\ue000b", "a b"},
+		{"long", strings.Repeat("x", maxOutputSize) + "end", strings.Repeat("x", maxOutputSize-3) + "end"},
+		// 3 byte runes do not fit 1024 bytes exactly, so the partial rune at the head is dropped.
+		{"rune boundary", strings.Repeat("あ", maxOutputSize), strings.Repeat("あ", maxOutputSize/3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncate(tt.in)
+			if got != tt.want {
+				t.Errorf("truncate(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			checkStatusDetails(t, map[string]string{"reason": got})
+		})
+	}
+}
@@ -3,19 +3,81 @@ package jobs
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 )
 
-// ErrorMessage represents messages if request failed
-type ErrorMessage struct {
-	ClientToken string `json:"clientToken"`
-	Timestamp   int    `json:"timestamp"`
-	Code        string `json:"code"`
-	Message     string `json:"message"`
+// ErrorCode is the code of the error response of AWS IoT Jobs.
+// https://docs.aws.amazon.com/iot/latest/developerguide/jobs-mqtt-https-api.html#jobs-mqtt-error-response
+type ErrorCode string
+
+const (
+	ErrorCodeInvalidTopic           ErrorCode = "InvalidTopic"
+	ErrorCodeInvalidJson            ErrorCode = "InvalidJson"
+	ErrorCodeInvalidRequest         ErrorCode = "InvalidRequest"
+	ErrorCodeInvalidStateTransition ErrorCode = "InvalidStateTransition"
+	ErrorCodeResourceNotFound       ErrorCode = "ResourceNotFound"
+	ErrorCodeVersionMismatch        ErrorCode = "VersionMismatch"
+	ErrorCodeInternalError          ErrorCode = "InternalError"
+	ErrorCodeRequestThrottled       ErrorCode = "RequestThrottled"
+	ErrorCodeTerminalStateReached   ErrorCode = "TerminalStateReached"
+)
+
+// Sentinel errors of the error codes, to be used with errors.Is.
+var (
+	ErrInvalidTopic           = errors.New(string(ErrorCodeInvalidTopic))
+	ErrInvalidJson            = errors.New(string(ErrorCodeInvalidJson))
+	ErrInvalidRequest         = errors.New(string(ErrorCodeInvalidRequest))
+	ErrInvalidStateTransition = errors.New(string(ErrorCodeInvalidStateTransition))
+	ErrResourceNotFound       = errors.New(string(ErrorCodeResourceNotFound))
+	ErrVersionMismatch        = errors.New(string(ErrorCodeVersionMismatch))
+	ErrInternalError          = errors.New(string(ErrorCodeInternalError))
+	ErrRequestThrottled       = errors.New(string(ErrorCodeRequestThrottled))
+	ErrTerminalStateReached   = errors.New(string(ErrorCodeTerminalStateReached))
+)
+
+var errorsByCode = map[ErrorCode]error{
+	ErrorCodeInvalidTopic:           ErrInvalidTopic,
+	ErrorCodeInvalidJson:            ErrInvalidJson,
+	ErrorCodeInvalidRequest:         ErrInvalidRequest,
+	ErrorCodeInvalidStateTransition: ErrInvalidStateTransition,
+	ErrorCodeResourceNotFound:       ErrResourceNotFound,
+	ErrorCodeVersionMismatch:        ErrVersionMismatch,
+	ErrorCodeInternalError:          ErrInternalError,
+	ErrorCodeRequestThrottled:       ErrRequestThrottled,
+	ErrorCodeTerminalStateReached:   ErrTerminalStateReached,
 }
 
+// RejectedError is the error response published to the rejected topic.
+type RejectedError struct {
+	ClientToken string    `json:"clientToken"`
+	Timestamp   int       `json:"timestamp"`
+	Code        ErrorCode `json:"code"`
+	Message     string    `json:"message"`
+
+	// The current state of the job execution. It is returned with VersionMismatch,
+	// so that it is unnecessary to describe the job execution again.
+	ExecutionState *JobExecutionState `json:"executionState,omitempty"`
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Is reports whether target is the sentinel error of the code, e.g. errors.Is(err, jobs.ErrVersionMismatch).
+func (e *RejectedError) Is(target error) bool {
+	sentinel, ok := errorsByCode[e.Code]
+	return ok && sentinel == target
+}
+
+// ErrorMessage represents messages if request failed.
+//
+// Deprecated: use RejectedError.
+type ErrorMessage = RejectedError
+
+// IsError returns *RejectedError if payload is an error response, or nil.
 func IsError(payload []byte) error {
-	var msg ErrorMessage
+	var msg RejectedError
 	if err := json.Unmarshal(payload, &msg); err != nil {
 		return nil // This is not a error message format
 	}
@@ -23,7 +85,7 @@ func IsError(payload []byte) error {
 		return nil
 	}
 
-	return fmt.Errorf(msg.Message)
+	return &msg
 }
 
 type JobExecutions []JobExecution
@@ -0,0 +1,238 @@
+// SPDX-License-Identifier: Apache-2.0
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/service/iotjobsdataplane/types"
+)
+
+const (
+	defaultMinReportInterval = 5 * time.Second
+
+	// limits of statusDetails of AWS IoT Jobs.
+	maxStatusDetails       = 10
+	maxStatusDetailKeySize = 128
+	maxStatusDetailSize    = 1024
+
+	// reasonKey is the status detail which Agent adds when the job execution did not succeed.
+	// It is reserved and counted in the limit, so that the final report does not exceed it.
+	reasonKey = "reason"
+)
+
+// ProgressReporter reports the progress of a job execution in statusDetails.
+// Changes are batched and reported at most once per MinInterval, and the step timeout is renewed
+// while Run is running even if nothing changed.
+type ProgressReporter struct {
+	client    *Client
+	thingName string
+	jobId     string
+
+	// MinInterval is the minimum interval between reports. The default is 5 seconds.
+	MinInterval time.Duration
+	// StepTimeout is set as stepTimeoutInMinutes with every report, and is renewed before half of it passes.
+	// It is rounded up to minutes. 0 means the step timeout is not changed.
+	StepTimeout time.Duration
+	// OnError is called when reporting fails in Run. Errors are discarded if nil.
+	OnError func(err error)
+
+	// flushMu serializes Flush, so that concurrent calls keep MinInterval between reports.
+	flushMu sync.Mutex
+
+	mu      sync.Mutex
+	details map[string]string
+	dirty   bool
+	last    time.Time // time of the last report
+}
+
+func NewProgressReporter(client *Client, thingName string, jobId string) (*ProgressReporter, error) {
+	if thingName == "" || jobId == "" {
+		return nil, fmt.Errorf("thing name and job id are required")
+	}
+	p := &ProgressReporter{
+		client:      client,
+		thingName:   thingName,
+		jobId:       jobId,
+		MinInterval: defaultMinReportInterval,
+		details:     make(map[string]string),
+	}
+
+	return p, nil
+}
+
+// Set sets a status detail to be reported. It returns an error if the key or the value is not allowed
+// in statusDetails, or if the number of details would exceed 9. The key "reason" is reserved for Agent.
+func (p *ProgressReporter) Set(key string, value string) error {
+	return p.SetDetails(map[string]string{key: value})
+}
+
+// SetDetails sets status details to be reported. Nothing is set if any of them is not allowed.
+func (p *ProgressReporter) SetDetails(details map[string]string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	added := 0
+	for k, v := range details {
+		if k == reasonKey {
+			return fmt.Errorf("status detail key %q is reserved", k)
+		}
+		if err := validateStatusDetail(k, v); err != nil {
+			return err
+		}
+		if _, ok := p.details[k]; !ok {
+			added++
+		}
+	}
+	if limit := maxStatusDetails - 1; len(p.details)+added > limit {
+		return fmt.Errorf("too many status details: %d > %d", len(p.details)+added, limit)
+	}
+
+	for k, v := range details {
+		if p.details[k] != v {
+			p.details[k] = v
+			p.dirty = true
+		}
+	}
+	return nil
+}
+
+// validateStatusDetails checks the number of the details and each of them against the limits of statusDetails.
+func validateStatusDetails(details map[string]string) error {
+	if len(details) > maxStatusDetails {
+		return fmt.Errorf("too many status details: %d > %d", len(details), maxStatusDetails)
+	}
+	for k, v := range details {
+		if err := validateStatusDetail(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateStatusDetail checks the key and the value against the limits of statusDetails:
+// keys are 1 to 128 characters of [a-zA-Z0-9:_-], and values are 1 to 1024 bytes matching [^\p{C}]+,
+// that is, without control, format or private use characters.
+func validateStatusDetail(key string, value string) error {
+	if key == "" || len(key) > maxStatusDetailKeySize || strings.IndexFunc(key, invalidKeyRune) >= 0 {
+		return fmt.Errorf("status detail key must be 1 to %d characters of [a-zA-Z0-9:_-]: %q", maxStatusDetailKeySize, key)
+	}
+	if value == "" || len(value) > maxStatusDetailSize {
+		return fmt.Errorf("status detail %s must be 1 to %d bytes", key, maxStatusDetailSize)
+	}
+	if !utf8.ValidString(value) || strings.IndexFunc(value, isOther) >= 0 {
+		return fmt.Errorf("status detail %s must be UTF-8 without control or format characters: %q", key, value)
+	}
+	return nil
+}
+
+// isOther reports whether r is in the Unicode category C, which values of statusDetails must not contain.
+func isOther(r rune) bool {
+	return unicode.Is(unicode.C, r)
+}
+
+func invalidKeyRune(r rune) bool {
+	switch {
+	case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		return false
+	case r == ':' || r == '_' || r == '-':
+		return false
+	}
+	return true
+}
+
+// Details returns a copy of the status details. Return it from JobHandler to keep them in the final report.
+func (p *ProgressReporter) Details() map[string]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ret := make(map[string]string, len(p.details))
+	for k, v := range p.details {
+		ret[k] = v
+	}
+	return ret
+}
+
+func (p *ProgressReporter) handleError(err error) {
+	if p.OnError != nil && err != nil {
+		p.OnError(err)
+	}
+}
+
+// due reports whether there are changes to report, or the step timeout needs to be renewed.
+func (p *ProgressReporter) due(now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if now.Sub(p.last) < p.MinInterval {
+		return false
+	}
+	return p.dirty || (p.StepTimeout > 0 && now.Sub(p.last) >= p.StepTimeout/2)
+}
+
+// Run reports the changes and renews the step timeout until ctx is done.
+func (p *ProgressReporter) Run(ctx context.Context) error {
+	interval := p.MinInterval
+	if interval <= 0 {
+		interval = defaultMinReportInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			if p.due(now) {
+				p.handleError(p.Flush(ctx))
+			}
+		}
+	}
+}
+
+// Flush reports the status details now with IN_PROGRESS. If the last report was within MinInterval,
+// it waits until MinInterval passes. Concurrent calls, e.g. by Run, are reported one by one.
+func (p *ProgressReporter) Flush(ctx context.Context) error {
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+
+	p.mu.Lock()
+	wait := p.MinInterval - time.Since(p.last)
+	p.mu.Unlock()
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	p.mu.Lock()
+	req := UpdateJobExecutionInput{
+		Status:               types.JobExecutionStatusInProgress,
+		StepTimeoutInMinutes: stepTimeoutInMinutes(p.StepTimeout),
+	}
+	if len(p.details) > 0 {
+		req.StatusDetails = make(map[string]string, len(p.details))
+		for k, v := range p.details {
+			req.StatusDetails[k] = v
+		}
+	}
+	p.dirty = false
+	p.last = time.Now()
+	p.mu.Unlock()
+
+	if _, err := p.client.UpdateJobExecution(ctx, p.thingName, p.jobId, req); err != nil {
+		p.mu.Lock()
+		p.dirty = true
+		p.mu.Unlock()
+		return fmt.Errorf("report progress of %s: %w", p.jobId, err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: Apache-2.0
+package jobs
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProgressReporterSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		ok    bool
+	}{
+		{"valid", "download:progress_1-a", "50%", true},
+		{"UTF-8 value", "file", "ファイル", true},
+		{"max key", strings.Repeat("k", maxStatusDetailKeySize), "v", true},
+		{"max value", "k", strings.Repeat("v", maxStatusDetailSize), true},
+		{"empty key", "", "v", false},
+		{"long key", strings.Repeat("k", maxStatusDetailKeySize+1), "v", false},
+		{"space in key", "download progress", "v", false},
+		{"dot in key", "download.progress", "v", false},
+		{"reserved key", "reason", "v", false},
+		{"empty value", "k", "", false},
+		{"long value", "k", strings.Repeat("v", maxStatusDetailSize+1), false},
+		{"newline in value", "k", "line 1\nline 2", false},
+		{"tab in value", "k", "a\tb", false},
+		{"invalid UTF-8 value", "k", "a\xffb", false},
+		{"BOM in value", "k", "\ufeffa", false},
+		{"zero width space in value", "k", "a\u200bb", false},
+		{"zero width joiner in value", "k", "👨\u200d👩", false},
+		{"private use in value", "k", "a\ue000", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewProgressReporter(nil, "thing", "job")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = p.Set(tt.key, tt.value)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Set(%q, %q) = %v", tt.key, tt.value, err)
+			}
+			if _, set := p.Details()[tt.key]; set != tt.ok {
+				t.Errorf("details = %v", p.Details())
+			}
+		})
+	}
+}
+
+func TestProgressReporterLimit(t *testing.T) {
+	p, err := NewProgressReporter(nil, "thing", "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one entry is left for the reason added by Agent.
+	for i := 0; i < maxStatusDetails-1; i++ {
+		if err := p.Set("k"+strconv.Itoa(i), "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Set("k0", "updated"); err != nil {
+		t.Errorf("updating an existing detail must not count: %v", err)
+	}
+	if err := p.Set("extra", "v"); err == nil {
+		t.Error("exceeding the limit must fail")
+	}
+	if err := p.SetDetails(map[string]string{"k1": "changed", "extra": "v"}); err == nil {
+		t.Error("exceeding the limit must fail")
+	}
+	if got := p.Details()["k1"]; got != "v" {
+		t.Errorf("nothing must be set when SetDetails fails: k1 = %q", got)
+	}
+}
+
+func TestProgressReporterFlushInterval(t *testing.T) {
+	b := newBroker()
+	client, _ := NewClient(b)
+	defer client.Close()
+	p, err := NewProgressReporter(client, "thing", "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.MinInterval = 50 * time.Millisecond
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.Flush(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.published) != 3 {
+		t.Fatalf("published %d reports", len(b.published))
+	}
+	for i := 1; i < len(b.published); i++ {
+		// allow the jitter of timers.
+		if gap := b.published[i].at.Sub(b.published[i-1].at); gap < p.MinInterval-5*time.Millisecond {
+			t.Errorf("reports %d and %d were sent within %s", i-1, i, gap)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: Apache-2.0
+package jobs
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RetryPolicy configures how requests are retried. Retries reuse the clientToken of the request,
+// so a late response to a previous attempt is also accepted.
+//
+// AWS IoT Jobs does not deduplicate requests by clientToken, so retrying an update after a timeout is not
+// idempotent: the first attempt may have been applied even though its response was lost. With ExpectedVersion
+// the retry is then rejected with VersionMismatch, and UpdateJobExecutionWithRetry calls mutate again with
+// the state which already has the first update. Set Retryable to exclude context.DeadlineExceeded if that
+// is not acceptable.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one. 0 or 1 means no retries.
+	MaxAttempts int
+
+	// InitialBackoff is the upper bound of the wait before the first retry. It is doubled on every retry
+	// up to MaxBackoff, and the actual wait is randomized between 0 and the bound (full jitter).
+	// If MaxBackoff is 0, the bound is not capped.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// Retryable reports whether the error should be retried. If nil, IsRetryable is used.
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy returns the retry policy recommended for slow connections, like cellular.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+	}
+}
+
+// PublishError is returned when publishing the request or subscribing the response topics failed.
+type PublishError struct {
+	Err error
+}
+
+func (e *PublishError) Error() string {
+	return "publish: " + e.Err.Error()
+}
+
+func (e *PublishError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable reports whether err is transient: RequestThrottled, InternalError,
+// a timeout waiting for the response, or a publish failure.
+func IsRetryable(err error) bool {
+	var pubErr *PublishError
+	return errors.Is(err, ErrRequestThrottled) ||
+		errors.Is(err, ErrInternalError) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &pubErr)
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+var jitter = struct {
+	sync.Mutex
+	*rand.Rand
+}{
+	Rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+}
+
+// backoff returns the wait before the retry of the attempt, which starts from 1.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	bound := p.InitialBackoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || bound < p.MaxBackoff) && bound <= math.MaxInt64/2; i++ {
+		bound *= 2
+	}
+	if p.MaxBackoff > 0 && bound > p.MaxBackoff {
+		bound = p.MaxBackoff
+	}
+	if bound <= 0 {
+		return 0
+	}
+
+	jitter.Lock()
+	defer jitter.Unlock()
+	return time.Duration(jitter.Int63n(int64(bound) + 1))
+}
+
+// retry calls fn until it succeeds, the error is not retryable, the attempts are exhausted or ctx is done.
+func retry[K any](ctx context.Context, p RetryPolicy, fn func() (K, error)) (ret K, err error) {
+	for attempt := 1; ; attempt++ {
+		ret, err = fn()
+		if err == nil || attempt >= p.MaxAttempts || ctx.Err() != nil || !p.retryable(err) {
+			return ret, err
+		}
+
+		timer := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ret, err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: Apache-2.0
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		bound   time.Duration
+	}{
+		{"no backoff", RetryPolicy{}, 1, 0},
+		{"first", policy, 1, 100 * time.Millisecond},
+		{"doubled", policy, 2, 200 * time.Millisecond},
+		{"doubled twice", policy, 3, 400 * time.Millisecond},
+		{"capped", policy, 5, time.Second},
+		{"capped later", policy, 100, time.Second},
+		{"initial above max", RetryPolicy{InitialBackoff: 2 * time.Second, MaxBackoff: time.Second}, 1, time.Second},
+		{"no max", RetryPolicy{InitialBackoff: 100 * time.Millisecond}, 4, 800 * time.Millisecond},
+		{"no max overflow", RetryPolicy{InitialBackoff: time.Second}, 1000, time.Second << 33},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var largest time.Duration
+			for i := 0; i < 200; i++ {
+				got := tt.policy.backoff(tt.attempt)
+				if got < 0 || got > tt.bound {
+					t.Fatalf("backoff(%d) = %v, want between 0 and %v", tt.attempt, got, tt.bound)
+				}
+				if got > largest {
+					largest = got
+				}
+			}
+			// full jitter spreads the waits up to the bound.
+			if largest < tt.bound/2 {
+				t.Errorf("backoff(%d) is at most %v, want up to %v", tt.attempt, largest, tt.bound)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"throttled", &RejectedError{Code: ErrorCodeRequestThrottled}, true},
+		{"internal error", fmt.Errorf("update: %w", &RejectedError{Code: ErrorCodeInternalError}), true},
+		{"timeout", fmt.Errorf("wait response: %w", context.DeadlineExceeded), true},
+		{"publish", &PublishError{Err: errors.New("not connected")}, true},
+		{"wrapped publish", fmt.Errorf("update: %w", &PublishError{Err: errors.New("not connected")}), true},
+		{"version mismatch", &RejectedError{Code: ErrorCodeVersionMismatch}, false},
+		{"invalid request", &RejectedError{Code: ErrorCodeInvalidRequest}, false},
+		{"terminal state", &RejectedError{Code: ErrorCodeTerminalStateReached}, false},
+		{"canceled", context.Canceled, false},
+		{"other", errors.New("other"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRejectedError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{"same code", &RejectedError{Code: ErrorCodeVersionMismatch}, ErrVersionMismatch, true},
+		{"wrapped", fmt.Errorf("update: %w", &RejectedError{Code: ErrorCodeResourceNotFound}), ErrResourceNotFound, true},
+		{"other code", &RejectedError{Code: ErrorCodeVersionMismatch}, ErrInvalidRequest, false},
+		{"unknown code", &RejectedError{Code: "Unknown"}, ErrInvalidRequest, false},
+		{"not a sentinel", &RejectedError{Code: ErrorCodeInvalidRequest}, errors.New(string(ErrorCodeInvalidRequest)), false},
+		{"deprecated alias", &ErrorMessage{Code: ErrorCodeTerminalStateReached}, ErrTerminalStateReached, true},
+		{"parsed", IsError([]byte(`{"code":"InvalidStateTransition","message":"m"}`)), ErrInvalidStateTransition, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, tt.target); got != tt.want {
+				t.Errorf("errors.Is(%v, %v) = %v, want %v", tt.err, tt.target, got, tt.want)
+			}
+
+			var rejected *RejectedError
+			if !errors.As(tt.err, &rejected) {
+				t.Fatalf("errors.As(%v) failed", tt.err)
+			}
+			if rejected.Error() != fmt.Sprintf("%s: %s", rejected.Code, rejected.Message) {
+				t.Errorf("Error() = %q", rejected.Error())
+			}
+		})
+	}
+
+	if err := IsError([]byte(`{"clientToken":"a"}`)); err != nil {
+		t.Errorf("IsError of an accepted response = %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+// SPDX-License-Identifier: Apache-2.0
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/shirou/aws-iot-device-lib/internal/mqttutils"
+)
+
+// response is a message received on an accepted or rejected topic.
+type response struct {
+	topic   string
+	payload []byte
+}
+
+// routeKey identifies the request which a response belongs to.
+type routeKey struct {
+	// pubTopic is the topic the request was published to, e.g. $aws/things/{thingName}/jobs/{jobId}/get.
+	pubTopic    string
+	clientToken string
+}
+
+// router keeps wildcard subscriptions to the accepted and rejected topics of every thing,
+// and dispatches the responses to the waiting requests.
+// paho keeps one route per topic filter, so there is one router per mqtt.Client, shared by all the Clients
+// of it. The subscriptions are kept until the last of them is closed.
+type router struct {
+	mc mqtt.Client
+
+	// refs is the number of Clients using the router. It is guarded by routers.
+	refs int
+
+	// subMu guards subs. It is separated from mu because subscribing waits for the broker,
+	// while the callback must not be blocked by it.
+	subMu sync.Mutex
+	subs  map[string]*mqttutils.Subscription
+
+	mu      sync.Mutex
+	waiters map[routeKey]chan response
+}
+
+var routers = struct {
+	sync.Mutex
+	m map[mqtt.Client]*router
+}{
+	m: make(map[mqtt.Client]*router),
+}
+
+// acquireRouter returns the router of the mqtt.Client, and counts the reference. release must be called
+// when it is no longer used.
+func acquireRouter(mc mqtt.Client) *router {
+	routers.Lock()
+	defer routers.Unlock()
+	r, ok := routers.m[mc]
+	if !ok {
+		r = &router{
+			mc:      mc,
+			subs:    make(map[string]*mqttutils.Subscription),
+			waiters: make(map[routeKey]chan response),
+		}
+		routers.m[mc] = r
+	}
+	r.refs++
+	return r
+}
+
+// release drops the reference. When the last one is released, the router is removed and
+// all the subscriptions are closed.
+func (r *router) release() error {
+	routers.Lock()
+	r.refs--
+	last := r.refs == 0
+	if last && routers.m[r.mc] == r {
+		delete(routers.m, r.mc)
+	}
+	routers.Unlock()
+
+	if !last {
+		return nil
+	}
+	return r.close()
+}
+
+// responseTopics returns the topic filters for the responses of the thing.
+// $aws/things/{thingName}/jobs/{get|start-next}/... and $aws/things/{thingName}/jobs/{jobId}/{get|update}/...
+func responseTopics(thingName string) []string {
+	prefix := fmt.Sprintf("$aws/things/%s/jobs", thingName)
+	return []string{
+		prefix + "/+/accepted",
+		prefix + "/+/rejected",
+		prefix + "/+/+/accepted",
+		prefix + "/+/+/rejected",
+	}
+}
+
+// subscribe subscribes the response topics of the thing if not yet.
+// If re-establishing the subscription after reconnect failed, it is subscribed again.
+func (r *router) subscribe(thingName string) error {
+	r.subMu.Lock()
+	defer r.subMu.Unlock()
+
+	if sub, ok := r.subs[thingName]; ok {
+		select {
+		case <-sub.Err():
+			sub.Close()
+			delete(r.subs, thingName)
+		default:
+			return nil
+		}
+	}
+
+	sub, err := mqttutils.Register(r.mc, responseTopics(thingName), 0, r.dispatch)
+	if err != nil {
+		return err
+	}
+	r.subs[thingName] = sub
+	return nil
+}
+
+// wait registers a waiter of the response of the request. The returned function must be called to unregister.
+// The same clientToken can not be waited for concurrently.
+func (r *router) wait(key routeKey) (<-chan response, func(), error) {
+	if key.clientToken == "" {
+		return nil, nil, fmt.Errorf("clientToken is required")
+	}
+	ch := make(chan response, 1)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.waiters[key]; ok {
+		return nil, nil, fmt.Errorf("clientToken %s is already in use", key.clientToken)
+	}
+	r.waiters[key] = ch
+
+	return ch, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.waiters[key] == ch {
+			delete(r.waiters, key)
+		}
+	}, nil
+}
+
+// dispatch is the callback of the subscriptions. It delivers the response to the request which has
+// the same topic and clientToken. Responses which nobody waits for, including ones without clientToken, are ignored.
+func (r *router) dispatch(mc mqtt.Client, msg mqtt.Message) {
+	topic := msg.Topic()
+	var pubTopic string
+	switch {
+	case strings.HasSuffix(topic, "/accepted"):
+		pubTopic = strings.TrimSuffix(topic, "/accepted")
+	case strings.HasSuffix(topic, "/rejected"):
+		pubTopic = strings.TrimSuffix(topic, "/rejected")
+	default:
+		return
+	}
+
+	var token struct {
+		ClientToken string `json:"clientToken"`
+	}
+	if err := json.Unmarshal(msg.Payload(), &token); err != nil || token.ClientToken == "" {
+		return
+	}
+	key := routeKey{pubTopic: pubTopic, clientToken: token.ClientToken}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ch, ok := r.waiters[key]
+	if !ok {
+		return
+	}
+	delete(r.waiters, key)
+	ch <- response{topic: topic, payload: msg.Payload()}
+}
+
+// close unsubscribes all the subscriptions.
+func (r *router) close() error {
+	r.subMu.Lock()
+	defer r.subMu.Unlock()
+
+	var errs []error
+	for thingName, sub := range r.subs {
+		errs = append(errs, sub.Close())
+		delete(r.subs, thingName)
+	}
+	return mqttutils.JoinErrors(errs...)
+}
@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: Apache-2.0
+package jobs
+
+import (
+	"testing"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+type message struct {
+	topic   string
+	payload []byte
+}
+
+func (m *message) Duplicate() bool   { return false }
+func (m *message) Qos() byte         { return 0 }
+func (m *message) Retained() bool    { return false }
+func (m *message) Topic() string     { return m.topic }
+func (m *message) MessageID() uint16 { return 0 }
+func (m *message) Payload() []byte   { return m.payload }
+func (m *message) Ack()              {}
+
+func TestRouterDispatch(t *testing.T) {
+	client, _ := NewClient(nil)
+	defer client.Close()
+	r := client.router
+	prefix := "$aws/things/thing/jobs"
+
+	startNext, doneStartNext, err := r.wait(routeKey{pubTopic: prefix + "/start-next", clientToken: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer doneStartNext()
+	update, doneUpdate, err := r.wait(routeKey{pubTopic: prefix + "/job1/update", clientToken: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer doneUpdate()
+
+	// responses of other requests, other jobs and without clientToken are ignored.
+	r.dispatch(nil, &message{topic: prefix + "/start-next/accepted", payload: []byte(`{"clientToken":"other"}`)})
+	r.dispatch(nil, &message{topic: prefix + "/get/accepted", payload: []byte(`{"clientToken":"a"}`)})
+	r.dispatch(nil, &message{topic: prefix + "/job2/update/accepted", payload: []byte(`{"clientToken":"a"}`)})
+	r.dispatch(nil, &message{topic: prefix + "/job1/update/accepted", payload: []byte(`{"timestamp":1}`)})
+	r.dispatch(nil, &message{topic: prefix + "/job1/update/accepted", payload: []byte(`not json`)})
+	select {
+	case res := <-startNext:
+		t.Fatalf("unexpected response %s", res.payload)
+	case res := <-update:
+		t.Fatalf("unexpected response %s", res.payload)
+	default:
+	}
+
+	r.dispatch(nil, &message{topic: prefix + "/start-next/accepted", payload: []byte(`{"clientToken":"a"}`)})
+	r.dispatch(nil, &message{topic: prefix + "/job1/update/rejected", payload: []byte(`{"clientToken":"a","code":"VersionMismatch"}`)})
+	// a duplicated response must not block the callback.
+	r.dispatch(nil, &message{topic: prefix + "/job1/update/rejected", payload: []byte(`{"clientToken":"a","code":"VersionMismatch"}`)})
+
+	if res := <-startNext; res.topic != prefix+"/start-next/accepted" {
+		t.Errorf("start-next: got %s", res.topic)
+	}
+	if res := <-update; res.topic != prefix+"/job1/update/rejected" {
+		t.Errorf("update: got %s", res.topic)
+	}
+}
+
+func TestRouterWait(t *testing.T) {
+	client, _ := NewClient(nil)
+	defer client.Close()
+	r := client.router
+	key := routeKey{pubTopic: "$aws/things/thing/jobs/job1/get", clientToken: "a"}
+
+	if _, _, err := r.wait(routeKey{pubTopic: key.pubTopic}); err == nil {
+		t.Error("waiting without clientToken must fail")
+	}
+
+	_, done, err := r.wait(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.wait(key); err == nil {
+		t.Error("waiting for the same clientToken concurrently must fail")
+	}
+	// the same clientToken can be used for another request.
+	_, doneOther, err := r.wait(routeKey{pubTopic: "$aws/things/thing/jobs/job1/update", clientToken: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer doneOther()
+
+	done()
+	ch, done, err := r.wait(key)
+	if err != nil {
+		t.Fatalf("clientToken must be reusable after done: %v", err)
+	}
+	defer done()
+
+	r.dispatch(nil, &message{topic: key.pubTopic + "/accepted", payload: []byte(`{"clientToken":"a"}`)})
+	if res := <-ch; string(res.payload) != `{"clientToken":"a"}` {
+		t.Errorf("got %s", res.payload)
+	}
+}
+
+func TestRouterShared(t *testing.T) {
+	mc := &struct{ mqtt.Client }{}
+	routerOf := func() *router {
+		routers.Lock()
+		defer routers.Unlock()
+		return routers.m[mc]
+	}
+
+	a, _ := NewClient(mc)
+	b, _ := NewClient(mc)
+	if a.router != b.router || routerOf() != a.router {
+		t.Fatal("router must be shared by the mqtt.Client")
+	}
+
+	// closing twice must not release the reference of b.
+	a.Close()
+	a.Close()
+	if routerOf() != b.router {
+		t.Fatal("router must be kept while b uses it")
+	}
+	b.Close()
+	if routerOf() != nil {
+		t.Error("router must be removed when the last Client is closed")
+	}
+
+	c, _ := NewClient(mc)
+	defer c.Close()
+	if c.router == a.router {
+		t.Error("a new router must be created after all the Clients are closed")
+	}
+}
@@ -1,33 +1,64 @@
 // SPDX-License-Identifier: Apache-2.0
 package jobs
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// ActionTypeRunHandler runs a handler script in the handler directory.
+	ActionTypeRunHandler = "runHandler"
+	// ActionTypeRunCommand runs a command given in the job document.
+	ActionTypeRunCommand = "runCommand"
+)
+
 // JobDocument represents JobDocument based on this document.
 // https://github.com/awslabs/aws-iot-device-client/tree/main/sample-job-docs
+// Job documents of other schemas can be decoded from JobExecution.RawJobDocument with DecodeJobDocument.
 type JobDocument struct {
 	Comment string `json:"_comment"`
 	Version string `json:"version"`
-	Steps   []struct {
-		Action struct {
-			Name  string `json:"name"`
-			Type  string `json:"type"`
-			Input struct {
-				Handler string   `json:"handler"`
-				Args    []string `json:"args"`
-				Path    string   `json:"path"`
-			} `json:"input"`
-			RunAsUser string `json:"runAsUser"`
-		} `json:"action"`
-	} `json:"steps"`
-	FinalStep struct {
-		Action struct {
-			Name  string `json:"name"`
-			Type  string `json:"type"`
-			Input struct {
-				Handler string   `json:"handler"`
-				Args    []string `json:"args"`
-				Path    string   `json:"path"`
-			} `json:"input"`
-			RunAsUser string `json:"runAsUser"`
-		} `json:"action"`
-	} `json:"finalStep"`
+	// Operation is the operation of the job, which is conventionally set to the job document by AWS IoT Jobs users.
+	Operation string `json:"operation,omitempty"`
+	Steps     []Step `json:"steps"`
+	// FinalStep is run after the steps, even if one of them failed. nil if not specified.
+	FinalStep *Step `json:"finalStep,omitempty"`
+
+	// decodeErr is the error of decoding the job document of a JobExecution, reported by Validate.
+	decodeErr error
+}
+
+type Step struct {
+	Action Action `json:"action"`
+}
+
+type Action struct {
+	Name string `json:"name"`
+	// Type is ActionTypeRunHandler or ActionTypeRunCommand.
+	Type      string      `json:"type"`
+	Input     ActionInput `json:"input"`
+	RunAsUser string      `json:"runAsUser"`
+}
+
+type ActionInput struct {
+	// Handler, Args and Path are used by runHandler. Path is the directory of the handler,
+	// or "default" for the handler directory of the executor.
+	Handler string   `json:"handler,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	Path    string   `json:"path,omitempty"`
+
+	// Command is used by runCommand. The command and its arguments are separated by commas,
+	// and a comma in an argument is escaped with a backslash, e.g. "echo,Hello\\, World".
+	Command string `json:"command,omitempty"`
+}
+
+// DecodeJobDocument decodes the job document of the job execution into T, for job documents of custom schemas.
+func DecodeJobDocument[T any](job *JobExecution) (T, error) {
+	var doc T
+	if len(job.RawJobDocument) == 0 {
+		return doc, fmt.Errorf("job document is not included")
+	}
+	err := json.Unmarshal(job.RawJobDocument, &doc)
+	return doc, err
 }
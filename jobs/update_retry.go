@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: Apache-2.0
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/iotjobsdataplane"
+)
+
+// maxVersionMismatchAttempts is the number of attempts of UpdateJobExecutionWithRetry on VersionMismatch.
+const maxVersionMismatchAttempts = 5
+
+// MutateFunc returns the update to apply to the current state of the job execution.
+// ExpectedVersion of the returned input is overwritten by the version of state.
+type MutateFunc func(state *JobExecutionState) UpdateJobExecutionInput
+
+// UpdateJobExecutionWithRetry updates the job execution with optimistic concurrency.
+// It describes the current state, applies mutate with ExpectedVersion, and if the update is rejected
+// with VersionMismatch, applies mutate again to the state returned with the error, so that updates
+// from multiple goroutines do not overwrite each other.
+// If the update timed out and is retried by the RetryPolicy, mutate may be called with a state which already
+// has its own previous update applied, so mutate must give the same result for it, e.g. set values instead of
+// incrementing them.
+func (client *Client) UpdateJobExecutionWithRetry(ctx context.Context, thingName string, jobId string, mutate MutateFunc) (ret iotjobsdataplane.UpdateJobExecutionOutput, err error) {
+	state, err := client.describeState(ctx, thingName, jobId)
+	if err != nil {
+		return
+	}
+
+	for i := 0; i < maxVersionMismatchAttempts; i++ {
+		req := mutate(state)
+		version := state.VersionNumber
+		req.ExpectedVersion = &version
+
+		ret, err = client.UpdateJobExecution(ctx, thingName, jobId, req)
+		if err == nil || !errors.Is(err, ErrVersionMismatch) {
+			return
+		}
+
+		var rejected *RejectedError
+		if errors.As(err, &rejected) && rejected.ExecutionState != nil {
+			state = rejected.ExecutionState
+			continue
+		}
+		if state, err = client.describeState(ctx, thingName, jobId); err != nil {
+			return
+		}
+	}
+	return ret, fmt.Errorf("update job execution %s: %d attempts: %w", jobId, maxVersionMismatchAttempts, err)
+}
+
+// describeState returns the current state of the job execution.
+func (client *Client) describeState(ctx context.Context, thingName string, jobId string) (*JobExecutionState, error) {
+	ret, err := client.DescribeJobExecution(ctx, thingName, jobId, DescribeJobExecutionInput{})
+	if err != nil {
+		return nil, err
+	}
+	if ret.Execution == nil {
+		return nil, fmt.Errorf("job execution %s is not returned", jobId)
+	}
+	return &JobExecutionState{
+		Status:        ret.Execution.Status,
+		StatusDetails: ret.Execution.StatusDetails,
+		VersionNumber: ret.Execution.VersionNumber,
+	}, nil
+}
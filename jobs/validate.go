@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: Apache-2.0
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// maxActionArgs is the maximum number of args of an action.
+	maxActionArgs = 32
+)
+
+// SupportedJobDocumentVersions are the versions of JobDocument accepted by Validate.
+var SupportedJobDocumentVersions = []string{"1.0"}
+
+// FieldError is a validation error of a field of the job document.
+type FieldError struct {
+	// Field is the path of the field, e.g. steps[0].action.input.handler.
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError has all the errors found in the job document.
+// Agent reports the job execution as REJECTED when the handler returns it.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Error())
+	}
+	return "invalid job document: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) add(field string, format string, args ...any) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks the version, the required fields of the steps, the action types, the handler paths
+// and the number of args. It returns *ValidationError with all the errors found, or nil.
+// If the job document of a JobExecution did not match the schema, only the decode error is returned.
+func (doc *JobDocument) Validate() error {
+	verr := &ValidationError{}
+
+	if doc.decodeErr != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(doc.decodeErr, &typeErr) && typeErr.Field != "" {
+			verr.add(typeErr.Field, "must be %s, not JSON %s", typeErr.Type, typeErr.Value)
+		} else {
+			verr.add("jobDocument", "%v", doc.decodeErr)
+		}
+		return verr
+	}
+	if doc.Version == "" {
+		verr.add("version", "is required")
+	} else if !contains(SupportedJobDocumentVersions, doc.Version) {
+		verr.add("version", "unsupported version %q", doc.Version)
+	}
+	if len(doc.Steps) == 0 && doc.FinalStep == nil {
+		verr.add("steps", "at least one step is required")
+	}
+	for i, step := range doc.Steps {
+		validateAction(verr, fmt.Sprintf("steps[%d].action", i), step.Action)
+	}
+	if doc.FinalStep != nil {
+		validateAction(verr, "finalStep.action", doc.FinalStep.Action)
+	}
+
+	if len(verr.Errors) == 0 {
+		return nil
+	}
+	return verr
+}
+
+func validateAction(verr *ValidationError, field string, a Action) {
+	if a.Name == "" {
+		verr.add(field+".name", "is required")
+	}
+	switch a.Type {
+	case "":
+		verr.add(field+".type", "is required")
+	case ActionTypeRunHandler:
+		switch {
+		case a.Input.Handler == "":
+			verr.add(field+".input.handler", "is required")
+		case a.Input.Handler == "." || a.Input.Handler == ".." || strings.ContainsAny(a.Input.Handler, `/\`):
+			verr.add(field+".input.handler", "must be a file name in the handler directory: %q", a.Input.Handler)
+		}
+		if hasParentRef(a.Input.Path) {
+			verr.add(field+".input.path", "must not contain \"..\": %q", a.Input.Path)
+		}
+		if len(a.Input.Args) > maxActionArgs {
+			verr.add(field+".input.args", "too many args: %d > %d", len(a.Input.Args), maxActionArgs)
+		}
+	case ActionTypeRunCommand:
+		args := splitCommand(a.Input.Command)
+		if len(args) == 0 || args[0] == "" {
+			verr.add(field+".input.command", "is required")
+		}
+		if len(args) > maxActionArgs+1 {
+			verr.add(field+".input.command", "too many args: %d > %d", len(args)-1, maxActionArgs)
+		}
+	default:
+		verr.add(field+".type", "unsupported action type %q, must be %s or %s", a.Type, ActionTypeRunHandler, ActionTypeRunCommand)
+	}
+}
+
+// hasParentRef reports whether the path has ".." as an element.
+func hasParentRef(path string) bool {
+	for _, elem := range strings.FieldsFunc(filepath.ToSlash(path), func(r rune) bool { return r == '/' || r == '\\' }) {
+		if elem == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,238 @@
+// SPDX-License-Identifier: Apache-2.0
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	handler := func(name string, input ActionInput) Step {
+		return Step{Action: Action{Name: name, Type: ActionTypeRunHandler, Input: input}}
+	}
+	command := func(name string, cmd string) Step {
+		return Step{Action: Action{Name: name, Type: ActionTypeRunCommand, Input: ActionInput{Command: cmd}}}
+	}
+
+	tests := []struct {
+		name string
+		doc  JobDocument
+		// fields of the errors, nil if valid.
+		want []string
+	}{
+		{
+			name: "valid",
+			doc: JobDocument{
+				Version: "1.0",
+				Steps: []Step{
+					handler("install", ActionInput{Handler: "install.sh", Args: []string{"pkg"}, Path: "default"}),
+					command("restart", "systemctl,restart,app"),
+				},
+				FinalStep: &Step{Action: Action{Name: "cleanup", Type: ActionTypeRunHandler, Input: ActionInput{Handler: "cleanup.sh"}}},
+			},
+		},
+		{
+			name: "final step only",
+			doc: JobDocument{
+				Version:   "1.0",
+				FinalStep: &Step{Action: Action{Name: "cleanup", Type: ActionTypeRunCommand, Input: ActionInput{Command: "true"}}},
+			},
+		},
+		{
+			name: "no version and steps",
+			doc:  JobDocument{},
+			want: []string{"version", "steps"},
+		},
+		{
+			name: "unsupported version",
+			doc:  JobDocument{Version: "2.0", Steps: []Step{command("a", "true")}},
+			want: []string{"version"},
+		},
+		{
+			name: "missing name and type",
+			doc:  JobDocument{Version: "1.0", Steps: []Step{{}}},
+			want: []string{"steps[0].action.name", "steps[0].action.type"},
+		},
+		{
+			name: "unsupported type",
+			doc:  JobDocument{Version: "1.0", Steps: []Step{{Action: Action{Name: "a", Type: "runScript"}}}},
+			want: []string{"steps[0].action.type"},
+		},
+		{
+			name: "handler",
+			doc: JobDocument{
+				Version: "1.0",
+				Steps: []Step{
+					handler("empty", ActionInput{}),
+					handler("slash", ActionInput{Handler: "../install.sh"}),
+					handler("backslash", ActionInput{Handler: `dir\install.sh`}),
+					handler("dot", ActionInput{Handler: ".."}),
+				},
+			},
+			want: []string{
+				"steps[0].action.input.handler",
+				"steps[1].action.input.handler",
+				"steps[2].action.input.handler",
+				"steps[3].action.input.handler",
+			},
+		},
+		{
+			name: "path with parent",
+			doc:  JobDocument{Version: "1.0", Steps: []Step{handler("a", ActionInput{Handler: "a.sh", Path: "/opt/../etc"})}},
+			want: []string{"steps[0].action.input.path"},
+		},
+		{
+			name: "too many args",
+			doc: JobDocument{
+				Version: "1.0",
+				Steps: []Step{
+					handler("a", ActionInput{Handler: "a.sh", Args: make([]string, maxActionArgs+1)}),
+					command("b", "echo"+strings.Repeat(",x", maxActionArgs+1)),
+				},
+			},
+			want: []string{"steps[0].action.input.args", "steps[1].action.input.command"},
+		},
+		{
+			name: "max args",
+			doc: JobDocument{
+				Version: "1.0",
+				Steps: []Step{
+					handler("a", ActionInput{Handler: "a.sh", Args: make([]string, maxActionArgs)}),
+					command("b", "echo"+strings.Repeat(",x", maxActionArgs)),
+				},
+			},
+		},
+		{
+			name: "empty command",
+			doc:  JobDocument{Version: "1.0", Steps: []Step{command("a", ""), command("b", ",x")}},
+			want: []string{"steps[0].action.input.command", "steps[1].action.input.command"},
+		},
+		{
+			name: "final step",
+			doc: JobDocument{
+				Version:   "1.0",
+				Steps:     []Step{command("a", "true")},
+				FinalStep: &Step{Action: Action{Name: "cleanup", Type: ActionTypeRunHandler}},
+			},
+			want: []string{"finalStep.action.input.handler"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.doc.Validate()
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Validate = %v", err)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Validate = %v, want *ValidationError", err)
+			}
+			var fields []string
+			for _, fe := range verr.Errors {
+				fields = append(fields, fe.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.want) {
+				t.Errorf("fields = %v, want %v", fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasParentRef(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"", false},
+		{"default", false},
+		{"/opt/handlers", false},
+		{"..", true},
+		{"../handlers", true},
+		{"/opt/../etc", true},
+		{"/opt/handlers/..", true},
+		{`C:\handlers\..\etc`, true},
+		{"/opt/..handlers", false},
+		{"/opt/handlers..", false},
+		{"/opt/.../handlers", false},
+	}
+	for _, tt := range tests {
+		if got := hasParentRef(tt.path); got != tt.want {
+			t.Errorf("hasParentRef(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"reboot", []string{"reboot"}},
+		{"echo,hello,world", []string{"echo", "hello", "world"}},
+		{" echo , hello ", []string{"echo", "hello"}},
+		{`echo,a\,b`, []string{"echo", "a,b"}},
+		{`echo,a\b`, []string{"echo", `a\b`}},
+		{"echo,", []string{"echo", ""}},
+		{",echo", []string{"", "echo"}},
+		{"echo,,x", []string{"echo", "", "x"}},
+	}
+	for _, tt := range tests {
+		if got := splitCommand(tt.command); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitCommand(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestValidateDecodeError(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		// fields of the errors, nil if valid.
+		want []string
+	}{
+		{"valid", `{"version":"1.0","steps":[{"action":{"name":"a","type":"runCommand","input":{"command":"true"}}}]}`, nil},
+		// the schema of aws-iot-device-client examples.
+		{"number version", `{"version":1.0,"steps":[]}`, []string{"version"}},
+		{"steps object", `{"version":"1.0","steps":{"action":{}}}`, []string{"steps"}},
+		{"not an object", `"install"`, []string{"jobDocument"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var job JobExecution
+			if err := json.Unmarshal([]byte(`{"jobId":"job1","jobDocument":`+tt.raw+`}`), &job); err != nil {
+				t.Fatal(err)
+			}
+			if string(job.RawJobDocument) != tt.raw {
+				t.Errorf("RawJobDocument = %s", job.RawJobDocument)
+			}
+
+			err := job.JobDocument.Validate()
+			var verr *ValidationError
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Validate = %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &verr) {
+				t.Fatalf("Validate = %v, want *ValidationError", err)
+			}
+			var fields []string
+			for _, fe := range verr.Errors {
+				fields = append(fields, fe.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.want) {
+				t.Errorf("fields = %v, want %v (%v)", fields, tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+// SPDX-License-Identifier: Apache-2.0
+package provisioning
+
+type CreateCertificateFromCsrInput struct {
+	// The CSR in PEM format.
+	//
+	// This member is required.
+	CertificateSigningRequest string `json:"certificateSigningRequest"`
+}
+
+type CreateCertificateFromCsrOutput struct {
+	// The certificate ID.
+	CertificateId string `json:"certificateId"`
+
+	// The certificate data in PEM format.
+	CertificatePem string `json:"certificatePem"`
+
+	// The token to prove ownership of the certificate during provisioning.
+	CertificateOwnershipToken string `json:"certificateOwnershipToken"`
+}
@@ -0,0 +1,19 @@
+// SPDX-License-Identifier: Apache-2.0
+package provisioning
+
+// CreateKeysAndCertificateInput is the request of CreateKeysAndCertificate. It has no parameters.
+type CreateKeysAndCertificateInput struct{}
+
+type CreateKeysAndCertificateOutput struct {
+	// The certificate ID.
+	CertificateId string `json:"certificateId"`
+
+	// The certificate data in PEM format.
+	CertificatePem string `json:"certificatePem"`
+
+	// The private key in PEM format.
+	PrivateKey string `json:"privateKey"`
+
+	// The token to prove ownership of the certificate during provisioning.
+	CertificateOwnershipToken string `json:"certificateOwnershipToken"`
+}
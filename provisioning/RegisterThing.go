@@ -0,0 +1,22 @@
+// SPDX-License-Identifier: Apache-2.0
+package provisioning
+
+type RegisterThingInput struct {
+	// The token to prove ownership of the certificate. The token is generated by
+	// AWS IoT when you create a certificate over MQTT.
+	//
+	// This member is required.
+	CertificateOwnershipToken string `json:"certificateOwnershipToken"`
+
+	// Optional. Key-value pairs from the device that are used by the pre-provisioning
+	// hooks to evaluate the registration request.
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+type RegisterThingOutput struct {
+	// The device configuration defined in the template.
+	DeviceConfiguration map[string]string `json:"deviceConfiguration"`
+
+	// The name of the IoT thing created during provisioning.
+	ThingName string `json:"thingName"`
+}
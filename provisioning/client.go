@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: Apache-2.0
+package provisioning
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/shirou/aws-iot-device-lib/codec"
+	"github.com/shirou/aws-iot-device-lib/internal/mqttutils"
+)
+
+// defaultTimeout is longer than jobs because creating a certificate takes time.
+const defaultTimeout = 10 * time.Second
+
+// Client is a Fleet Provisioning client. The mqtt.Client is usually connected with a claim certificate.
+// https://docs.aws.amazon.com/iot/latest/developerguide/fleet-provision-api.html
+type Client struct {
+	mc       mqtt.Client
+	codec    codec.Codec
+	Timeouts time.Duration
+}
+
+func NewClient(mc mqtt.Client) (*Client, error) {
+	client := &Client{
+		mc:       mc,
+		codec:    codec.JSON,
+		Timeouts: defaultTimeout,
+	}
+
+	return client, nil
+}
+
+// SetTimeout sets the timeout before a response is returned for an accepted or rejected topic.
+// The default is 10 seconds.
+func (client *Client) SetTimeout(dur time.Duration) {
+	client.Timeouts = dur
+}
+
+// SetCodec sets the payload format. The default is codec.JSON.
+// The topics are chosen by the format, e.g. codec.CBOR uses $aws/certificates/create/cbor.
+func (client *Client) SetCodec(c codec.Codec) {
+	client.codec = c
+}
+
+type outputType interface {
+	CreateKeysAndCertificateOutput |
+		CreateCertificateFromCsrOutput |
+		RegisterThingOutput
+}
+
+// handleAsync is a generic processing function.
+// Fleet Provisioning does not have clientToken, so requests on the same topic must not be sent concurrently.
+func handleAsync[K outputType](ctx context.Context, mc mqtt.Client, c codec.Codec, payload []byte, subTopics []string, pubTopic string) (ret K, err error) {
+	accepted := make(chan K, 1)
+	rejected := make(chan error, 1)
+	callback := func(mc mqtt.Client, msg mqtt.Message) {
+		if strings.HasSuffix(msg.Topic(), "accepted") {
+			var output K
+			if err := c.Unmarshal(msg.Payload(), &output); err != nil {
+				send(rejected, err)
+				return
+			}
+			send(accepted, output)
+		} else if strings.HasSuffix(msg.Topic(), "rejected") {
+			if err := isError(c, msg.Payload()); err != nil {
+				send(rejected, err)
+				return
+			}
+			send(rejected, fmt.Errorf("rejected"))
+		} else {
+			send(rejected, fmt.Errorf("unknown topic subscribed, %s", msg.Topic()))
+		}
+	}
+
+	if err = mqttutils.Subscribe(mc, subTopics, 1, callback); err != nil {
+		return
+	}
+	defer func() {
+		err = mqttutils.JoinErrors(err, mqttutils.Unsubscribe(mc, subTopics))
+	}()
+
+	if err = mqttutils.Publish(mc, pubTopic, 1, payload); err != nil {
+		return
+	}
+	select {
+	case r := <-accepted:
+		return r, nil
+	case err = <-rejected:
+		return ret, err
+	case <-ctx.Done():
+		return ret, ctx.Err()
+	}
+}
+
+// send sends v to ch without blocking the paho router when nobody is waiting anymore.
+func send[V any](ch chan V, v V) {
+	select {
+	case ch <- v:
+	default:
+	}
+}
+
+// request sends req to the topic of the operation followed by the payload format.
+func request[K outputType](ctx context.Context, client *Client, operation string, req any) (ret K, err error) {
+	pubTopic := operation + "/" + client.codec.Format()
+	topics := []string{
+		pubTopic + "/accepted",
+		pubTopic + "/rejected",
+	}
+
+	payload, err := client.codec.Marshal(req)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, client.Timeouts)
+	defer cancel()
+	return handleAsync[K](ctx, client.mc, client.codec, payload, topics, pubTopic)
+}
+
+// CreateKeysAndCertificate creates new keys and a certificate signed by the AWS IoT certificate authority.
+func (client *Client) CreateKeysAndCertificate(ctx context.Context, req CreateKeysAndCertificateInput) (ret CreateKeysAndCertificateOutput, err error) {
+	return request[CreateKeysAndCertificateOutput](ctx, client, "$aws/certificates/create", req)
+}
+
+// CreateCertificateFromCsr creates a certificate from a certificate signing request (CSR).
+// The private key never leaves the device.
+func (client *Client) CreateCertificateFromCsr(ctx context.Context, req CreateCertificateFromCsrInput) (ret CreateCertificateFromCsrOutput, err error) {
+	return request[CreateCertificateFromCsrOutput](ctx, client, "$aws/certificates/create-from-csr", req)
+}
+
+// RegisterThing provisions a thing using the provisioning template.
+func (client *Client) RegisterThing(ctx context.Context, templateName string, req RegisterThingInput) (ret RegisterThingOutput, err error) {
+	operation := fmt.Sprintf("$aws/provisioning-templates/%s/provision", templateName)
+
+	return request[RegisterThingOutput](ctx, client, operation, req)
+}
@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: Apache-2.0
+package provisioning
+
+import (
+	"fmt"
+
+	"github.com/shirou/aws-iot-device-lib/codec"
+)
+
+// ErrorMessage represents messages if request failed
+// https://docs.aws.amazon.com/iot/latest/developerguide/fleet-provision-api.html
+type ErrorMessage struct {
+	StatusCode   int    `json:"statusCode"`
+	ErrorCode    string `json:"errorCode"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+func (msg *ErrorMessage) Error() string {
+	return fmt.Sprintf("provisioning rejected: %d %s %s", msg.StatusCode, msg.ErrorCode, msg.ErrorMessage)
+}
+
+// IsError returns an *ErrorMessage if the payload is an error response.
+func IsError(payload []byte) error {
+	return isError(codec.JSON, payload)
+}
+
+func isError(c codec.Codec, payload []byte) error {
+	var msg ErrorMessage
+	if err := c.Unmarshal(payload, &msg); err != nil {
+		return nil // This is not a error message format
+	}
+	if msg.StatusCode == 0 && msg.ErrorCode == "" {
+		return nil
+	}
+
+	return &msg
+}
@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: Apache-2.0
+package provisioning
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CredentialStore stores the permanent certificate and private key issued by provisioning.
+type CredentialStore interface {
+	// Save stores the certificate and private key in PEM format to a new location, without replacing
+	// the current credentials, and returns the file paths to be used as connect.ConnectionArgs.
+	Save(certPEM []byte, keyPEM []byte) (certPath string, keyPath string, err error)
+	// Commit makes the credentials saved at the paths the current ones, after the certificate is registered.
+	Commit(certPath string, keyPath string) error
+}
+
+const (
+	currentLink     = "current"
+	attemptPattern  = "credentials-*"
+	certificateFile = "cert.pem"
+	privateKeyFile  = "key.pem"
+)
+
+// FileStore stores the certificate and private key to the files in Dir.
+// Every Save writes both files to a new directory in Dir, and Commit switches the symlink Dir/current to it
+// by a rename, so the current certificate and key are always replaced together.
+// Use CurrentPaths to connect with the committed credentials, e.g. after a restart.
+type FileStore struct {
+	Dir string
+}
+
+// CurrentPaths returns the paths of the committed certificate and private key.
+func (store FileStore) CurrentPaths() (certPath string, keyPath string) {
+	return filepath.Join(store.Dir, currentLink, certificateFile), filepath.Join(store.Dir, currentLink, privateKeyFile)
+}
+
+func (store FileStore) Save(certPEM []byte, keyPEM []byte) (string, string, error) {
+	if store.Dir == "" {
+		return "", "", fmt.Errorf("please specify directory")
+	}
+	if err := os.MkdirAll(store.Dir, 0700); err != nil {
+		return "", "", err
+	}
+	dir, err := os.MkdirTemp(store.Dir, attemptPattern)
+	if err != nil {
+		return "", "", err
+	}
+
+	certPath, keyPath := filepath.Join(dir, certificateFile), filepath.Join(dir, privateKeyFile)
+	if err := writeFile(keyPath, keyPEM, 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", "", err
+	}
+	if err := writeFile(certPath, certPEM, 0644); err != nil {
+		os.RemoveAll(dir)
+		return "", "", err
+	}
+	return certPath, keyPath, nil
+}
+
+// Commit switches Dir/current to the directory of the paths returned by Save, and removes the directories
+// of the other attempts.
+func (store FileStore) Commit(certPath string, keyPath string) error {
+	dir := filepath.Dir(certPath)
+	if filepath.Dir(keyPath) != dir || filepath.Dir(dir) != filepath.Clean(store.Dir) {
+		return fmt.Errorf("%s and %s are not saved by the store", certPath, keyPath)
+	}
+
+	// a symlink can not be replaced in place, so a new one is renamed over it.
+	link := filepath.Join(store.Dir, currentLink)
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(filepath.Base(dir), tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	syncDir(store.Dir)
+
+	// the others are previous credentials or attempts whose certificate was not registered.
+	attempts, _ := filepath.Glob(filepath.Join(store.Dir, attemptPattern))
+	for _, attempt := range attempts {
+		if filepath.Base(attempt) != filepath.Base(dir) {
+			os.RemoveAll(attempt)
+		}
+	}
+	return nil
+}
+
+// writeFile writes data to the new file at path and syncs it.
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir syncs the directory so that the renamed entry survives a power loss.
+// It is best effort because not every platform supports syncing a directory.
+func syncDir(path string) {
+	if d, err := os.Open(path); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: Apache-2.0
+package provisioning
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	store := FileStore{Dir: filepath.Join(t.TempDir(), "credentials")}
+	read := func(path string) string {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	cert1, key1, err := store.Save([]byte("cert1"), []byte("key1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Commit(cert1, key1); err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath := store.CurrentPaths()
+	if read(certPath) != "cert1" || read(keyPath) != "key1" {
+		t.Fatal("the committed credentials must be current")
+	}
+	if info, err := os.Stat(key1); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("key mode = %v, %v", info.Mode(), err)
+	}
+
+	// saved but not committed, e.g. RegisterThing failed.
+	cert2, key2, err := store.Save([]byte("cert2"), []byte("key2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert2 == cert1 || read(certPath) != "cert1" || read(keyPath) != "key1" {
+		t.Fatal("Save must not replace the current credentials")
+	}
+
+	cert3, key3, err := store.Save([]byte("cert3"), []byte("key3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Commit(cert3, key3); err != nil {
+		t.Fatal(err)
+	}
+	if read(certPath) != "cert3" || read(keyPath) != "key3" || read(cert3) != "cert3" {
+		t.Fatal("the committed credentials must be current")
+	}
+	for _, path := range []string{cert1, key2} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s must be removed: %v", path, err)
+		}
+	}
+
+	if err := store.Commit(filepath.Join(t.TempDir(), "cert.pem"), filepath.Join(t.TempDir(), "key.pem")); err == nil {
+		t.Error("paths which are not saved by the store must be rejected")
+	}
+}
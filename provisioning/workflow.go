@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: Apache-2.0
+package provisioning
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/shirou/aws-iot-device-lib/codec"
+	"github.com/shirou/aws-iot-device-lib/connect"
+)
+
+// Provisioner runs the whole provisioning by claim workflow.
+type Provisioner struct {
+	// Store stores the permanent certificate and private key.
+	Store CredentialStore
+
+	// Base is used to fill the returned ConnectionArgs such as Endpoint, CAFile and Port.
+	// Usually it is the ConnectionArgs of the claim connection. ClientID, Signer and CertificateStore
+	// are not copied because they belong to the claim identity.
+	Base connect.ConnectionArgs
+
+	// Optional. The payload format of the provisioning topics. The default is codec.JSON.
+	Codec codec.Codec
+}
+
+// Provision generates a private key locally, creates a certificate from the CSR, stores the certificate and key,
+// registers the thing with the template, and commits the credentials to the store. The private key is never sent to AWS IoT.
+// If registering fails, the current credentials of the store are kept, and the saved ones are not committed.
+// If only committing fails, the returned ConnectionArgs can still be used with the error.
+// claimConn is an mqtt.Client connected with the claim certificate.
+// It returns the ConnectionArgs to reconnect with the permanent identity.
+func (p *Provisioner) Provision(ctx context.Context, claimConn mqtt.Client, template string, params map[string]string) (ret connect.ConnectionArgs, err error) {
+	if p.Store == nil {
+		return ret, fmt.Errorf("please specify credential store")
+	}
+	client, err := NewClient(claimConn)
+	if err != nil {
+		return
+	}
+	if p.Codec != nil {
+		client.SetCodec(p.Codec)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, key)
+	if err != nil {
+		return
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return
+	}
+
+	cert, err := client.CreateCertificateFromCsr(ctx, CreateCertificateFromCsrInput{
+		CertificateSigningRequest: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+	})
+	if err != nil {
+		return ret, fmt.Errorf("create certificate: %w", err)
+	}
+
+	// save the credentials before the certificate is activated by RegisterThing,
+	// so that the private key of an active certificate is never lost. They replace the current
+	// credentials only after the registration succeeded.
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	certPath, keyPath, err := p.Store.Save([]byte(cert.CertificatePem), keyPEM)
+	if err != nil {
+		return ret, fmt.Errorf("save credentials: %w", err)
+	}
+
+	thing, err := client.RegisterThing(ctx, template, RegisterThingInput{
+		CertificateOwnershipToken: cert.CertificateOwnershipToken,
+		Parameters:                params,
+	})
+	if err != nil {
+		return ret, fmt.Errorf("register thing: %w", err)
+	}
+
+	ret = p.Base
+	// the identity of the claim connection must not be used with the permanent certificate.
+	ret.ClientID = ""
+	ret.Signer = nil
+	ret.CertificateStore = nil
+	ret.Cert = certPath
+	ret.Key = keyPath
+	ret.ThingName = thing.ThingName
+	if err := p.Store.Commit(certPath, keyPath); err != nil {
+		return ret, fmt.Errorf("commit credentials: %w", err)
+	}
+	return ret, nil
+}
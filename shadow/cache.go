@@ -0,0 +1,356 @@
+// SPDX-License-Identifier: Apache-2.0
+package shadow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/shirou/aws-iot-device-lib/internal/mqttutils"
+)
+
+// maxFlushAttempts is the number of attempts to flush when the version has been changed by others.
+const maxFlushAttempts = 3
+
+// cacheState is the content of the cache file. The state is kept untyped to preserve explicit nulls of pending updates.
+type cacheState struct {
+	Version  int64          `json:"version"`
+	Desired  map[string]any `json:"desired,omitempty"`
+	Reported map[string]any `json:"reported,omitempty"`
+
+	// Pending is the merged reported state which has not been sent yet.
+	Pending map[string]any `json:"pending,omitempty"`
+}
+
+// rawUpdateInput is an update request with an untyped state.
+type rawUpdateInput struct {
+	State       map[string]any `json:"state"`
+	Version     *int64         `json:"version,omitempty"`
+	ClientToken string         `json:"clientToken,omitempty"`
+}
+
+// Cache keeps the last known document of a shadow on disk and queues updates of the reported state while offline.
+// Queued updates are coalesced into a single update, and flushed when the connection is re-established.
+type Cache[T any] struct {
+	shadow *Shadow[T]
+	path   string
+
+	// PollInterval is the interval to check whether the connection has been re-established.
+	PollInterval time.Duration
+	// OnError is called when flushing in background fails. Errors are discarded if nil.
+	OnError func(err error)
+
+	// flushMu serializes Flush. It is held during the requests, while mu is not,
+	// so that the update/documents callback on the paho router is never blocked by them.
+	flushMu sync.Mutex
+
+	mu    sync.Mutex
+	state cacheState
+	// pendingSeq is incremented every time Pending is changed, to detect changes during Flush.
+	pendingSeq uint64
+}
+
+// NewCache creates a Cache of the shadow stored at path. If the file exists, the last known document and
+// the pending updates are loaded from it.
+func NewCache[T any](s *Shadow[T], path string) (*Cache[T], error) {
+	c := &Cache[T]{
+		shadow:       s,
+		path:         path,
+		PollInterval: defaultPollInterval,
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeJSON(b, &c.state); err != nil {
+		return nil, fmt.Errorf("invalid cache file %s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// decodeJSON decodes b keeping numbers as json.Number.
+func decodeJSON(b []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// save writes the state to the file atomically. c.mu must be held.
+func (c *Cache[T]) save() error {
+	b, err := json.Marshal(c.state)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// Version returns the last known version of the shadow.
+func (c *Cache[T]) Version() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state.Version
+}
+
+// Desired returns the last known desired state. It returns nil if unknown.
+func (c *Cache[T]) Desired() (*T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return fromObject[T](c.state.Desired)
+}
+
+// Reported returns the last known reported state including the pending updates. It returns nil if unknown.
+func (c *Cache[T]) Reported() (*T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return fromObject[T](c.state.Reported)
+}
+
+// Pending returns true if there are updates which have not been sent yet.
+func (c *Cache[T]) Pending() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.state.Pending) > 0
+}
+
+// DiscardPending discards the updates which have not been sent yet.
+func (c *Cache[T]) DiscardPending() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state.Pending = nil
+	c.pendingSeq++
+	return c.save()
+}
+
+// Update merges the partial reported state into the pending updates and persists them.
+// deletes are dot separated paths to be deleted from the reported state.
+// If the client is connected, the pending updates are flushed immediately. Otherwise, or if flushing fails,
+// they are kept and flushed later by Run. Errors of flushing are passed to OnError.
+func (c *Cache[T]) Update(ctx context.Context, reported *T, deletes ...string) error {
+	patch, err := partialState(reported, deletes)
+	if err != nil {
+		return err
+	}
+	if patch == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	// Merge removes nulls from the patch, so merge a copy into Pending.
+	c.state.Pending = mergeKeepNull(c.state.Pending, copyObject(patch))
+	c.pendingSeq++
+	c.state.Reported = Merge(c.state.Reported, patch)
+	err = c.save()
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if c.shadow.client.mc.IsConnectionOpen() {
+		c.handleError(c.Flush(ctx))
+	}
+	return nil
+}
+
+// mergeKeepNull merges patch into doc like Merge, but keeps nil values to send them as explicit nulls.
+func mergeKeepNull(doc map[string]any, patch map[string]any) map[string]any {
+	if doc == nil {
+		doc = make(map[string]any, len(patch))
+	}
+	for k, v := range patch {
+		p, ok := v.(map[string]any)
+		if !ok {
+			doc[k] = v
+			continue
+		}
+		d, ok := doc[k].(map[string]any)
+		if !ok {
+			d = nil
+		}
+		doc[k] = mergeKeepNull(d, p)
+	}
+	return doc
+}
+
+func (c *Cache[T]) handleError(err error) {
+	if c.OnError != nil && err != nil {
+		c.OnError(err)
+	}
+}
+
+// refresh fetches the current document and stores it with the pending updates applied.
+// It returns nil version if the shadow does not exist. c.mu must not be held.
+func (c *Cache[T]) refresh(ctx context.Context) (*int64, error) {
+	doc, err := c.shadow.raw().Get(ctx, GetShadowInput{})
+	if err != nil {
+		var msg *ErrorMessage
+		if errors.As(err, &msg) && msg.Code == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if doc.Version < c.state.Version {
+		// a newer document has been received by update/documents in the meantime.
+		version := c.state.Version
+		return &version, nil
+	}
+	c.state.Version = doc.Version
+	c.state.Desired = nil
+	if doc.State.Desired != nil {
+		c.state.Desired = *doc.State.Desired
+	}
+	c.state.Reported = nil
+	if doc.State.Reported != nil {
+		c.state.Reported = *doc.State.Reported
+	}
+	c.state.Reported = Merge(c.state.Reported, copyObject(c.state.Pending))
+	return &doc.Version, nil
+}
+
+// copyObject returns a deep copy of the JSON object.
+func copyObject(obj map[string]any) map[string]any {
+	if obj == nil {
+		return nil
+	}
+	ret := make(map[string]any, len(obj))
+	for k, v := range obj {
+		if m, ok := v.(map[string]any); ok {
+			v = copyObject(m)
+		}
+		ret[k] = v
+	}
+	return ret
+}
+
+// Flush fetches the current document and sends the pending updates as a single update with its version.
+// If the version has been changed by others in the meantime, it is retried with the new version.
+// The pending updates are cleared only if they have not been changed while they were sent.
+func (c *Cache[T]) Flush(ctx context.Context) error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	var err error
+	for i := 0; i < maxFlushAttempts; i++ {
+		var version *int64
+		if version, err = c.refresh(ctx); err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		if len(c.state.Pending) == 0 {
+			err = c.save()
+			c.mu.Unlock()
+			return err
+		}
+		pending := copyObject(c.state.Pending)
+		seq := c.pendingSeq
+		c.mu.Unlock()
+
+		req := rawUpdateInput{
+			State:       map[string]any{"reported": pending},
+			Version:     version,
+			ClientToken: newClientToken(""),
+		}
+		var out UpdateShadowOutput[map[string]any]
+		out, err = request[map[string]any, UpdateShadowOutput[map[string]any]](ctx, c.shadow.raw().client, c.shadow.topicPrefix(), "update", req.ClientToken, req)
+		var msg *ErrorMessage
+		if errors.As(err, &msg) && msg.Code == http.StatusConflict {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		if out.Version > c.state.Version {
+			c.state.Version = out.Version
+		}
+		if c.pendingSeq == seq {
+			c.state.Pending = nil
+		}
+		err = c.save()
+		c.mu.Unlock()
+		return err
+	}
+	return err
+}
+
+// Run flushes the pending updates at the start and every time after the connection is re-established,
+// and keeps the cached document up to date with the update/documents topic until ctx is done.
+func (c *Cache[T]) Run(ctx context.Context) error {
+	mc := c.shadow.client.mc
+	topics := []string{c.shadow.topicPrefix() + "/update/documents"}
+
+	callback := func(mc mqtt.Client, msg mqtt.Message) {
+		var docs DocumentsMessage[map[string]any]
+		if err := decodeJSON(msg.Payload(), &docs); err != nil {
+			c.handleError(err)
+			return
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if docs.Current.Version <= c.state.Version {
+			return
+		}
+		c.state.Version = docs.Current.Version
+		c.state.Desired = nil
+		if docs.Current.State.Desired != nil {
+			c.state.Desired = *docs.Current.State.Desired
+		}
+		c.state.Reported = nil
+		if docs.Current.State.Reported != nil {
+			c.state.Reported = *docs.Current.State.Reported
+		}
+		c.state.Reported = Merge(c.state.Reported, copyObject(c.state.Pending))
+		c.handleError(c.save())
+	}
+	sub, err := mqttutils.Register(mc, topics, 0, callback)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	go mqttutils.WatchConnection(ctx, mc, c.PollInterval, func() {
+		c.handleError(c.Flush(ctx))
+	})
+	c.handleError(c.Flush(ctx))
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-sub.Err():
+		return err
+	}
+}
@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: Apache-2.0
+package shadow
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// offline is an mqtt.Client which is never connected.
+type offline struct {
+	mqtt.Client
+}
+
+func (offline) IsConnectionOpen() bool { return false }
+
+func TestCacheUpdateCoalesce(t *testing.T) {
+	client, _ := NewClient[device](offline{})
+	path := filepath.Join(t.TempDir(), "shadow.json")
+	c, err := NewCache(client.Shadow("thing", ""), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := c.Update(ctx, &device{Power: ptr("on"), Network: &network{SSID: ptr("home")}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Update(ctx, &device{Count: 2}, "network.ssid", "power"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Update(ctx, &device{Power: ptr("off"), Network: &network{Channel: ptr(6)}}); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Pending() {
+		t.Fatal("the updates must be pending while offline")
+	}
+
+	// the updates are coalesced into one, and the deleted path is kept as null.
+	wantPending := `{"power":"off","count":0,"network":{"ssid":null,"channel":6}}`
+	wantReported := `{"power":"off","count":0,"network":{"channel":6}}`
+	check := func(c *Cache[device]) {
+		t.Helper()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, tt := range []struct {
+			name string
+			got  map[string]any
+			want string
+		}{
+			{"Pending", c.state.Pending, wantPending},
+			{"Reported", c.state.Reported, wantReported},
+		} {
+			b, _ := json.Marshal(tt.got)
+			if !reflect.DeepEqual(decode(t, string(b)), decode(t, tt.want)) {
+				t.Errorf("%s = %s, want %s", tt.name, b, tt.want)
+			}
+		}
+	}
+	check(c)
+
+	// the pending updates survive a restart.
+	loaded, err := NewCache(client.Shadow("thing", ""), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(loaded)
+
+	if err := loaded.DiscardPending(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Pending() {
+		t.Error("the updates must be discarded")
+	}
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: Apache-2.0
+package shadow
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/shirou/aws-iot-device-lib/internal/mqttutils"
+)
+
+// shadowNameFromTopic extracts the shadow name from a topic like
+// $aws/things/{thingName}/shadow/name/{shadowName}/update/delta.
+// It returns an empty string for the classic shadow.
+func shadowNameFromTopic(topic string) string {
+	parts := strings.Split(topic, "/")
+	if len(parts) > 5 && parts[4] == "name" {
+		return parts[5]
+	}
+	return ""
+}
+
+// handleChanged subscribes topics and calls handler on every message until ctx is done.
+// The subscription is re-established on reconnect. If it failed, the error is returned.
+func handleChanged[T any, V any](ctx context.Context, client *Client[T], thingName string, topics []string, handler func(s *Shadow[T], msg V) error) error {
+	callback := func(mc mqtt.Client, msg mqtt.Message) {
+		var v V
+		if err := json.Unmarshal(msg.Payload(), &v); err != nil {
+			// TODO: how to log the error?
+			return
+		}
+		go handler(client.Shadow(thingName, shadowNameFromTopic(msg.Topic())), v)
+	}
+	sub, err := mqttutils.Register(client.mc, topics, 0, callback)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-sub.Err():
+		return err
+	}
+}
+
+type DeltaHandler[T any] func(s *Shadow[T], msg DeltaMessage[T]) error
+
+// Delta subscribes to the update/delta topic of the shadow and calls handler on every delta until ctx is done.
+func (s *Shadow[T]) Delta(ctx context.Context, handler DeltaHandler[T]) error {
+	topics := []string{s.topicPrefix() + "/update/delta"}
+
+	return handleChanged(ctx, s.client, s.ThingName, topics, handler)
+}
+
+type DocumentsHandler[T any] func(s *Shadow[T], msg DocumentsMessage[T]) error
+
+// Documents subscribes to the update/documents topic of the shadow and calls handler on every update until ctx is done.
+func (s *Shadow[T]) Documents(ctx context.Context, handler DocumentsHandler[T]) error {
+	topics := []string{s.topicPrefix() + "/update/documents"}
+
+	return handleChanged(ctx, s.client, s.ThingName, topics, handler)
+}
+
+// NamedShadowsDelta subscribes to the update/delta topic of every named shadow of the thing with one wildcard subscription.
+// The handler receives the Shadow the delta belongs to.
+func (client *Client[T]) NamedShadowsDelta(ctx context.Context, thingName string, handler DeltaHandler[T]) error {
+	topics := []string{topicPrefix(thingName, "+") + "/update/delta"}
+
+	return handleChanged(ctx, client, thingName, topics, handler)
+}
+
+// NamedShadowsDocuments subscribes to the update/documents topic of every named shadow of the thing with one wildcard subscription.
+// The handler receives the Shadow the document belongs to.
+func (client *Client[T]) NamedShadowsDocuments(ctx context.Context, thingName string, handler DocumentsHandler[T]) error {
+	topics := []string{topicPrefix(thingName, "+") + "/update/documents"}
+
+	return handleChanged(ctx, client, thingName, topics, handler)
+}
@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: Apache-2.0
+package shadow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+	"github.com/shirou/aws-iot-device-lib/internal/mqttutils"
+)
+
+const defaultTimeout = 1 * time.Second
+
+// Client is a Device Shadow client. T is the user defined state struct of the shadow document.
+// Use map[string]any as T to handle the document without a schema.
+type Client[T any] struct {
+	mc       mqtt.Client
+	Timeouts time.Duration
+}
+
+func NewClient[T any](mc mqtt.Client) (*Client[T], error) {
+	client := &Client[T]{
+		mc:       mc,
+		Timeouts: defaultTimeout,
+	}
+
+	return client, nil
+}
+
+// SetTimeout sets the timeout before a response is returned for an accepted or rejected topic.
+// The default is 1 second. In a slow connection environment, it is recommended to set a longer time.
+func (client *Client[T]) SetTimeout(dur time.Duration) {
+	client.Timeouts = dur
+}
+
+type outputType[T any] interface {
+	GetShadowOutput[T] |
+		UpdateShadowOutput[T] |
+		DeleteShadowOutput
+}
+
+// send sends v to ch without blocking the paho router when nobody is waiting anymore.
+func send[V any](ch chan V, v V) {
+	select {
+	case ch <- v:
+	default:
+	}
+}
+
+// newClientToken returns clientToken if it is given, or generates a new one.
+func newClientToken(clientToken string) string {
+	if clientToken != "" {
+		return clientToken
+	}
+	return uuid.NewString()
+}
+
+// request publishes req and waits for the response dispatched by the router of the mqtt.Client.
+// Responses which do not have the given clientToken are ignored, because accepted and rejected topics
+// are shared with every client updating the same shadow.
+func request[T any, K outputType[T]](ctx context.Context, client *Client[T], prefix string, operation string, clientToken string, req any) (ret K, err error) {
+	pubTopic := fmt.Sprintf("%s/%s", prefix, operation)
+
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return
+	}
+	r := routerOf(client.mc)
+	if err = r.subscribe(prefix); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, client.Timeouts)
+	defer cancel()
+
+	ch, done, err := r.wait(routeKey{pubTopic: pubTopic, clientToken: clientToken})
+	if err != nil {
+		return
+	}
+	defer done()
+
+	if err = mqttutils.Publish(client.mc, pubTopic, 0, payload); err != nil {
+		return
+	}
+
+	select {
+	case res := <-ch:
+		if strings.HasSuffix(res.topic, "/rejected") {
+			if err = IsError(res.payload); err != nil {
+				return
+			}
+			return ret, fmt.Errorf("rejected")
+		}
+		err = json.Unmarshal(res.payload, &ret)
+		return
+	case <-ctx.Done():
+		return ret, ctx.Err()
+	}
+}
+
+// Get gets the classic shadow document of a thing.
+func (client *Client[T]) Get(ctx context.Context, thingName string, req GetShadowInput) (ret GetShadowOutput[T], err error) {
+	return client.Shadow(thingName, "").Get(ctx, req)
+}
+
+// Update creates the classic shadow if it doesn't exist, or updates the contents of an existing shadow with the state information provided in the request.
+func (client *Client[T]) Update(ctx context.Context, thingName string, req UpdateShadowInput[T]) (ret UpdateShadowOutput[T], err error) {
+	return client.Shadow(thingName, "").Update(ctx, req)
+}
+
+// Delete deletes the classic shadow document of a thing.
+func (client *Client[T]) Delete(ctx context.Context, thingName string, req DeleteShadowInput) (ret DeleteShadowOutput, err error) {
+	return client.Shadow(thingName, "").Delete(ctx, req)
+}
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: Apache-2.0
+package shadow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Merge applies patch to doc with the same semantics as the Device Shadow service:
+// objects are merged recursively, a nil value deletes the key and any other value replaces the existing one.
+// doc is modified in place and returned. If doc is nil, a new map is allocated.
+func Merge(doc map[string]any, patch map[string]any) map[string]any {
+	if doc == nil {
+		doc = make(map[string]any, len(patch))
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(doc, k)
+			continue
+		}
+		p, ok := v.(map[string]any)
+		if !ok {
+			doc[k] = v
+			continue
+		}
+		d, ok := doc[k].(map[string]any)
+		if !ok {
+			d = nil
+		}
+		doc[k] = Merge(d, p)
+	}
+	return doc
+}
+
+// toObject converts v to a JSON object. Numbers are kept as json.Number to avoid losing precision.
+func toObject(v any) (map[string]any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var obj map[string]any
+	if err := dec.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("state must be a JSON object: %w", err)
+	}
+	return obj, nil
+}
+
+// setNull sets null to the dot separated path like "a.b.c", creating intermediate objects if needed.
+func setNull(obj map[string]any, path string) {
+	keys := strings.Split(path, ".")
+	for _, k := range keys[:len(keys)-1] {
+		child, ok := obj[k].(map[string]any)
+		if !ok {
+			child = make(map[string]any)
+			obj[k] = child
+		}
+		obj = child
+	}
+	obj[keys[len(keys)-1]] = nil
+}
+
+// partialState builds a partial state section from v and the paths to be deleted.
+// It returns nil if there is nothing to send.
+func partialState[T any](v *T, deletes []string) (map[string]any, error) {
+	if v == nil && len(deletes) == 0 {
+		return nil, nil
+	}
+	obj := make(map[string]any)
+	if v != nil {
+		var err error
+		if obj, err = toObject(v); err != nil {
+			return nil, err
+		}
+		if obj == nil {
+			obj = make(map[string]any)
+		}
+	}
+	for _, path := range deletes {
+		setNull(obj, path)
+	}
+	return obj, nil
+}
+
+// fromObject converts a JSON object to T. It returns nil if obj is nil.
+func fromObject[T any](obj map[string]any) (*T, error) {
+	if obj == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var v T
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
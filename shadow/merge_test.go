@@ -0,0 +1,181 @@
+// SPDX-License-Identifier: Apache-2.0
+package shadow
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type network struct {
+	SSID    *string `json:"ssid,omitempty"`
+	Channel *int    `json:"channel,omitempty"`
+}
+
+type device struct {
+	Power   *string  `json:"power,omitempty"`
+	Network *network `json:"network,omitempty"`
+	Count   int      `json:"count"`
+}
+
+func ptr[V any](v V) *V { return &v }
+
+// decode decodes the JSON document for comparison.
+func decode(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	return v
+}
+
+func TestUpdateShadowInputMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		req  UpdateShadowInput[device]
+		want string
+	}{
+		{"empty", UpdateShadowInput[device]{}, `{"state":{}}`},
+		{
+			"desired and reported",
+			UpdateShadowInput[device]{Desired: &device{Power: ptr("on")}, Reported: &device{Count: 1}, Version: ptr(int64(3)), ClientToken: "a"},
+			`{"state":{"desired":{"power":"on","count":0},"reported":{"count":1}},"version":3,"clientToken":"a"}`,
+		},
+		{
+			"delete desired",
+			UpdateShadowInput[device]{DeleteDesired: []string{"power"}},
+			`{"state":{"desired":{"power":null}}}`,
+		},
+		{
+			"delete nested paths",
+			UpdateShadowInput[device]{DeleteDesired: []string{"network.ssid", "network.channel", "a.b.c"}},
+			`{"state":{"desired":{"network":{"ssid":null,"channel":null},"a":{"b":{"c":null}}}}}`,
+		},
+		{
+			"delete nested path with desired",
+			UpdateShadowInput[device]{Desired: &device{Network: &network{SSID: ptr("home")}}, DeleteDesired: []string{"network.channel"}},
+			`{"state":{"desired":{"count":0,"network":{"ssid":"home","channel":null}}}}`,
+		},
+		{
+			"delete path under a value",
+			UpdateShadowInput[device]{Desired: &device{Power: ptr("on")}, DeleteDesired: []string{"power.level"}},
+			`{"state":{"desired":{"count":0,"power":{"level":null}}}}`,
+		},
+		{
+			"delete reported",
+			UpdateShadowInput[device]{Reported: &device{Count: 2}, DeleteReported: []string{"network.ssid"}},
+			`{"state":{"reported":{"count":2,"network":{"ssid":null}}}}`,
+		},
+		{
+			"clear reported",
+			UpdateShadowInput[device]{Desired: &device{Count: 1}, Reported: &device{Count: 2}, DeleteReported: []string{"power"}, ClearReported: true},
+			`{"state":{"desired":{"count":1},"reported":null}}`,
+		},
+		{
+			"clear desired",
+			UpdateShadowInput[device]{Desired: &device{Count: 1}, DeleteDesired: []string{"power"}, ClearDesired: true},
+			`{"state":{"desired":null}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decode(t, string(got)), decode(t, tt.want)) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"nil doc", `null`, `{"a":1,"b":null}`, `{"a":1}`},
+		{"replace", `{"a":1,"b":2}`, `{"a":3}`, `{"a":3,"b":2}`},
+		{"delete", `{"a":1,"b":2}`, `{"a":null,"c":null}`, `{"b":2}`},
+		{"nested", `{"a":{"b":1,"c":2}}`, `{"a":{"b":3,"c":null,"d":4}}`, `{"a":{"b":3,"d":4}}`},
+		{"object replaces value", `{"a":1}`, `{"a":{"b":1,"c":null}}`, `{"a":{"b":1}}`},
+		{"value replaces object", `{"a":{"b":1}}`, `{"a":[1,2]}`, `{"a":[1,2]}`},
+		{"empty object", `{"a":{"b":1}}`, `{"a":{}}`, `{"a":{"b":1}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, _ := decode(t, tt.doc).(map[string]any)
+			got := Merge(doc, decode(t, tt.patch).(map[string]any))
+			if want := decode(t, tt.want); !reflect.DeepEqual(any(got), want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestMergeKeepNull(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"nil doc", `null`, `{"a":1,"b":null}`, `{"a":1,"b":null}`},
+		{"null replaces value", `{"a":1,"b":2}`, `{"a":null}`, `{"a":null,"b":2}`},
+		{"value replaces null", `{"a":null}`, `{"a":1}`, `{"a":1}`},
+		{"nested", `{"a":{"b":1,"c":2}}`, `{"a":{"c":null,"d":{"e":null}}}`, `{"a":{"b":1,"c":null,"d":{"e":null}}}`},
+		{"object replaces null", `{"a":null}`, `{"a":{"b":null}}`, `{"a":{"b":null}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, _ := decode(t, tt.doc).(map[string]any)
+			got := mergeKeepNull(doc, decode(t, tt.patch).(map[string]any))
+			if want := decode(t, tt.want); !reflect.DeepEqual(any(got), want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPartialState(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       *device
+		deletes []string
+		want    string
+	}{
+		{"nothing", nil, nil, `null`},
+		{"value", &device{Power: ptr("on")}, nil, `{"power":"on","count":0}`},
+		{"deletes only", nil, []string{"power", "network.ssid"}, `{"power":null,"network":{"ssid":null}}`},
+		{"value and deletes", &device{Network: &network{Channel: ptr(6)}}, []string{"network.ssid"}, `{"count":0,"network":{"channel":6,"ssid":null}}`},
+		{"delete overrides value", &device{Power: ptr("on")}, []string{"power"}, `{"power":null,"count":0}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := partialState(tt.v, tt.deletes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := json.Marshal(got)
+			if !reflect.DeepEqual(decode(t, string(b)), decode(t, tt.want)) {
+				t.Errorf("got %s, want %s", b, tt.want)
+			}
+		})
+	}
+
+	// numbers keep their precision.
+	got, err := partialState(&map[string]any{"n": json.Number("9007199254740993")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["n"] != json.Number("9007199254740993") {
+		t.Errorf("got %v", got["n"])
+	}
+	if _, err := partialState(ptr("not an object"), nil); err == nil {
+		t.Error("a state which is not a JSON object must fail")
+	}
+}
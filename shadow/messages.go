@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: Apache-2.0
+package shadow
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ErrorMessage represents messages if request failed
+// https://docs.aws.amazon.com/iot/latest/developerguide/device-shadow-error-messages.html
+type ErrorMessage struct {
+	ClientToken string `json:"clientToken"`
+	Timestamp   int64  `json:"timestamp"`
+	Code        int    `json:"code"`
+	Message     string `json:"message"`
+}
+
+func (msg *ErrorMessage) Error() string {
+	return fmt.Sprintf("shadow rejected: %d %s", msg.Code, msg.Message)
+}
+
+// IsError returns an *ErrorMessage if the payload is an error response.
+func IsError(payload []byte) error {
+	var msg ErrorMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return nil // This is not a error message format
+	}
+	if msg.Code == 0 {
+		return nil
+	}
+
+	return &msg
+}
+
+// DeltaMessage is sent to the update/delta topic when the desired state differs from the reported state.
+type DeltaMessage[T any] struct {
+	// Only the attributes of the desired state which differ from the reported state.
+	State    T              `json:"state"`
+	Metadata map[string]any `json:"metadata"`
+	Version  int64          `json:"version"`
+
+	ClientToken string `json:"clientToken"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+// DocumentSnapshot is the previous or current document contained in DocumentsMessage.
+type DocumentSnapshot[T any] struct {
+	State    ShadowState[T] `json:"state"`
+	Metadata Metadata       `json:"metadata"`
+	Version  int64          `json:"version"`
+}
+
+// DocumentsMessage is sent to the update/documents topic whenever the shadow is updated.
+type DocumentsMessage[T any] struct {
+	Previous DocumentSnapshot[T] `json:"previous"`
+	Current  DocumentSnapshot[T] `json:"current"`
+
+	ClientToken string `json:"clientToken"`
+	Timestamp   int64  `json:"timestamp"`
+}
@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: Apache-2.0
+package shadow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/shirou/aws-iot-device-lib/internal/mqttutils"
+)
+
+const (
+	defaultPollInterval  = 1 * time.Second
+	defaultRetryInterval = 10 * time.Second
+)
+
+// ApplyFunc applies the delta to the device and returns the partial state to be reported.
+// If the returned reported state is nil, nothing is reported.
+type ApplyFunc[T any] func(ctx context.Context, delta T) (reported *T, err error)
+
+// Reconciler drives the device state toward the desired state of a shadow.
+// It applies every delta with ApplyFunc and reports the result to the shadow.
+type Reconciler[T any] struct {
+	shadow *Shadow[T]
+	apply  ApplyFunc[T]
+
+	// PollInterval is the interval to check whether the connection has been re-established.
+	PollInterval time.Duration
+	// RetryInterval is the interval to retry fetching the full document when it or reconciling a delta failed.
+	RetryInterval time.Duration
+	// OnError is called when applying or reporting fails. Errors are discarded if nil.
+	OnError func(err error)
+
+	// reconcileMu serializes reconcile, so that deltas are applied in order.
+	reconcileMu sync.Mutex
+	// mu guards version. It is not held while applying or reporting, so that Version does not block.
+	mu      sync.Mutex
+	version int64 // version of the last applied delta or document
+}
+
+func NewReconciler[T any](s *Shadow[T], apply ApplyFunc[T]) (*Reconciler[T], error) {
+	if apply == nil {
+		return nil, fmt.Errorf("apply function is required")
+	}
+	r := &Reconciler[T]{
+		shadow:        s,
+		apply:         apply,
+		PollInterval:  defaultPollInterval,
+		RetryInterval: defaultRetryInterval,
+	}
+
+	return r, nil
+}
+
+// Version returns the version of the shadow document which was applied last.
+func (r *Reconciler[T]) Version() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.version
+}
+
+func (r *Reconciler[T]) handleError(err error) {
+	if r.OnError != nil && err != nil {
+		r.OnError(err)
+	}
+}
+
+// Run subscribes to the delta topic and reconciles until ctx is done.
+// The full document is fetched at the start and every time after the connection is re-established,
+// because deltas may be lost while disconnected.
+// The subscription is re-established on reconnect. If it failed, the error is returned.
+func (r *Reconciler[T]) Run(ctx context.Context) error {
+	mc := r.shadow.client.mc
+	topics := []string{r.shadow.topicPrefix() + "/update/delta"}
+
+	deltas := make(chan DeltaMessage[T], 16)
+	resync := make(chan struct{}, 1)
+	notifyResync := func() {
+		send(resync, struct{}{})
+	}
+
+	callback := func(mc mqtt.Client, msg mqtt.Message) {
+		var delta DeltaMessage[T]
+		if err := json.Unmarshal(msg.Payload(), &delta); err != nil {
+			r.handleError(err)
+			return
+		}
+		select {
+		case deltas <- delta:
+		default:
+			// too many deltas are queued. fetch the full document instead.
+			notifyResync()
+		}
+	}
+	sub, err := mqttutils.Register(mc, topics, 0, callback)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	go mqttutils.WatchConnection(ctx, mc, r.PollInterval, notifyResync)
+	notifyResync()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.Err():
+			return err
+		case <-resync:
+			if err := r.Resync(ctx); err != nil {
+				r.handleError(err)
+				time.AfterFunc(r.RetryInterval, notifyResync)
+			}
+		case delta := <-deltas:
+			if err := r.reconcile(ctx, delta.Version, &delta.State); err != nil {
+				r.handleError(err)
+				time.AfterFunc(r.RetryInterval, notifyResync)
+			}
+		}
+	}
+}
+
+// Resync fetches the full shadow document and applies its delta.
+func (r *Reconciler[T]) Resync(ctx context.Context) error {
+	doc, err := r.shadow.Get(ctx, GetShadowInput{})
+	if err != nil {
+		var msg *ErrorMessage
+		if errors.As(err, &msg) && msg.Code == http.StatusNotFound {
+			return nil // no shadow yet, nothing to reconcile
+		}
+		return err
+	}
+	return r.reconcile(ctx, doc.Version, doc.State.Delta)
+}
+
+// reconcile applies the delta of the version and reports the result. Stale deltas are dropped.
+// The version is not advanced when applying or reporting failed, so that the delta is applied again by
+// the next Resync. Run schedules it after RetryInterval.
+func (r *Reconciler[T]) reconcile(ctx context.Context, version int64, delta *T) error {
+	r.reconcileMu.Lock()
+	defer r.reconcileMu.Unlock()
+
+	if version <= r.Version() {
+		return nil
+	}
+	if delta == nil {
+		r.setVersion(version)
+		return nil
+	}
+
+	reported, err := r.apply(ctx, *delta)
+	if err != nil {
+		return fmt.Errorf("apply version %d: %w", version, err)
+	}
+	if reported == nil {
+		r.setVersion(version)
+		return nil
+	}
+
+	req := UpdateShadowInput[T]{
+		Reported: reported,
+	}
+	if _, err := r.shadow.Update(ctx, req); err != nil {
+		return fmt.Errorf("report version %d: %w", version, err)
+	}
+	r.setVersion(version)
+	return nil
+}
+
+func (r *Reconciler[T]) setVersion(version int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.version = version
+}
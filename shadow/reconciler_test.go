@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: Apache-2.0
+package shadow
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type state struct {
+	Power *string `json:"power,omitempty"`
+}
+
+func TestReconcilerVersion(t *testing.T) {
+	client, _ := NewClient[state](nil)
+	applying, release := make(chan struct{}), make(chan struct{})
+	fail := true
+	r, _ := NewReconciler(client.Shadow("thing", ""), func(ctx context.Context, delta state) (*state, error) {
+		applying <- struct{}{}
+		<-release
+		if fail {
+			return nil, errors.New("device is busy")
+		}
+		return nil, nil
+	})
+
+	errc := make(chan error, 1)
+	go func() { errc <- r.reconcile(context.Background(), 2, &state{}) }()
+	<-applying
+	// Version must not wait for apply.
+	done := make(chan int64, 1)
+	go func() { done <- r.Version() }()
+	select {
+	case v := <-done:
+		if v != 0 {
+			t.Errorf("Version = %d while applying", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Version blocked while applying")
+	}
+	close(release)
+	if err := <-errc; err == nil {
+		t.Fatal("the apply error must be returned")
+	}
+	if v := r.Version(); v != 0 {
+		t.Errorf("Version = %d after the failure, want 0", v)
+	}
+
+	// the failed delta is applied again.
+	fail = false
+	go func() { <-applying }()
+	if err := r.reconcile(context.Background(), 2, &state{}); err != nil {
+		t.Fatal(err)
+	}
+	if v := r.Version(); v != 2 {
+		t.Errorf("Version = %d, want 2", v)
+	}
+	// stale deltas are dropped without applying.
+	if err := r.reconcile(context.Background(), 1, &state{}); err != nil {
+		t.Fatal(err)
+	}
+}
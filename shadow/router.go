@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: Apache-2.0
+package shadow
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/shirou/aws-iot-device-lib/internal/mqttutils"
+)
+
+// response is a message received on an accepted or rejected topic.
+type response struct {
+	topic   string
+	payload []byte
+}
+
+// routeKey identifies the request which a response belongs to.
+type routeKey struct {
+	// pubTopic is the topic the request was published to, e.g. $aws/things/{thingName}/shadow/get.
+	pubTopic    string
+	clientToken string
+}
+
+// router keeps wildcard subscriptions to the accepted and rejected topics of every shadow,
+// and dispatches the responses to the waiting requests by clientToken.
+// paho keeps one route per topic filter, so there is one router per mqtt.Client, shared by all the Clients
+// regardless of the type parameter. The subscriptions are kept while the mqtt.Client is used.
+type router struct {
+	mc mqtt.Client
+
+	// subMu guards subs. It is separated from mu because subscribing waits for the broker,
+	// while the callback must not be blocked by it.
+	subMu sync.Mutex
+	subs  map[string]*mqttutils.Subscription
+
+	mu      sync.Mutex
+	waiters map[routeKey]chan response
+}
+
+var routers = struct {
+	sync.Mutex
+	m map[mqtt.Client]*router
+}{
+	m: make(map[mqtt.Client]*router),
+}
+
+// routerOf returns the router of the mqtt.Client.
+func routerOf(mc mqtt.Client) *router {
+	routers.Lock()
+	defer routers.Unlock()
+	r, ok := routers.m[mc]
+	if !ok {
+		r = &router{
+			mc:      mc,
+			subs:    make(map[string]*mqttutils.Subscription),
+			waiters: make(map[routeKey]chan response),
+		}
+		routers.m[mc] = r
+	}
+	return r
+}
+
+// responseTopics returns the topic filters for the responses of get, update and delete of the shadow.
+func responseTopics(prefix string) []string {
+	return []string{
+		prefix + "/+/accepted",
+		prefix + "/+/rejected",
+	}
+}
+
+// subscribe subscribes the response topics of the shadow of prefix if not yet.
+// If re-establishing the subscription after reconnect failed, it is subscribed again.
+func (r *router) subscribe(prefix string) error {
+	r.subMu.Lock()
+	defer r.subMu.Unlock()
+
+	if sub, ok := r.subs[prefix]; ok {
+		select {
+		case <-sub.Err():
+			sub.Close()
+			delete(r.subs, prefix)
+		default:
+			return nil
+		}
+	}
+
+	sub, err := mqttutils.Register(r.mc, responseTopics(prefix), 0, r.dispatch)
+	if err != nil {
+		return err
+	}
+	r.subs[prefix] = sub
+	return nil
+}
+
+// wait registers a waiter of the response of the request. The returned function must be called to unregister.
+// The same clientToken can not be waited for concurrently.
+func (r *router) wait(key routeKey) (<-chan response, func(), error) {
+	if key.clientToken == "" {
+		return nil, nil, fmt.Errorf("clientToken is required")
+	}
+	ch := make(chan response, 1)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.waiters[key]; ok {
+		return nil, nil, fmt.Errorf("clientToken %s is already in use", key.clientToken)
+	}
+	r.waiters[key] = ch
+
+	return ch, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.waiters[key] == ch {
+			delete(r.waiters, key)
+		}
+	}, nil
+}
+
+// dispatch is the callback of the subscriptions. It delivers the response to the request which has
+// the same topic and clientToken. Responses of other clients updating the same shadow are ignored.
+func (r *router) dispatch(mc mqtt.Client, msg mqtt.Message) {
+	topic := msg.Topic()
+	var pubTopic string
+	switch {
+	case strings.HasSuffix(topic, "/accepted"):
+		pubTopic = strings.TrimSuffix(topic, "/accepted")
+	case strings.HasSuffix(topic, "/rejected"):
+		pubTopic = strings.TrimSuffix(topic, "/rejected")
+	default:
+		return
+	}
+
+	var token struct {
+		ClientToken string `json:"clientToken"`
+	}
+	if err := json.Unmarshal(msg.Payload(), &token); err != nil || token.ClientToken == "" {
+		return
+	}
+	key := routeKey{pubTopic: pubTopic, clientToken: token.ClientToken}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ch, ok := r.waiters[key]
+	if !ok {
+		return
+	}
+	delete(r.waiters, key)
+	ch <- response{topic: topic, payload: msg.Payload()}
+}
@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: Apache-2.0
+package shadow
+
+import (
+	"testing"
+)
+
+type message struct {
+	topic   string
+	payload []byte
+}
+
+func (m *message) Duplicate() bool   { return false }
+func (m *message) Qos() byte         { return 0 }
+func (m *message) Retained() bool    { return false }
+func (m *message) Topic() string     { return m.topic }
+func (m *message) MessageID() uint16 { return 0 }
+func (m *message) Payload() []byte   { return m.payload }
+func (m *message) Ack()              {}
+
+func TestRouterDispatch(t *testing.T) {
+	r := routerOf(nil)
+	prefix := topicPrefix("thing", "")
+
+	chA, doneA, err := r.wait(routeKey{pubTopic: prefix + "/update", clientToken: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer doneA()
+	chB, doneB, err := r.wait(routeKey{pubTopic: prefix + "/update", clientToken: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer doneB()
+
+	if _, _, err := r.wait(routeKey{pubTopic: prefix + "/update", clientToken: "a"}); err == nil {
+		t.Error("waiting for the same clientToken concurrently must fail")
+	}
+	if _, _, err := r.wait(routeKey{pubTopic: prefix + "/update"}); err == nil {
+		t.Error("waiting without clientToken must fail")
+	}
+
+	// responses of other clients, other operations and without clientToken are ignored.
+	r.dispatch(nil, &message{topic: prefix + "/update/accepted", payload: []byte(`{"clientToken":"other"}`)})
+	r.dispatch(nil, &message{topic: prefix + "/get/accepted", payload: []byte(`{"clientToken":"a"}`)})
+	r.dispatch(nil, &message{topic: prefix + "/update/accepted", payload: []byte(`{"version":1}`)})
+	select {
+	case res := <-chA:
+		t.Fatalf("unexpected response %s", res.payload)
+	case res := <-chB:
+		t.Fatalf("unexpected response %s", res.payload)
+	default:
+	}
+
+	r.dispatch(nil, &message{topic: prefix + "/update/rejected", payload: []byte(`{"clientToken":"b","code":409}`)})
+	r.dispatch(nil, &message{topic: prefix + "/update/accepted", payload: []byte(`{"clientToken":"a","version":2}`)})
+
+	if res := <-chA; res.topic != prefix+"/update/accepted" {
+		t.Errorf("a: got %s", res.topic)
+	}
+	if res := <-chB; res.topic != prefix+"/update/rejected" {
+		t.Errorf("b: got %s", res.topic)
+	}
+}
+
+func TestRouterOf(t *testing.T) {
+	// every Client of the same mqtt.Client shares the router, whatever the type parameter is.
+	a, _ := NewClient[map[string]any](nil)
+	b, _ := NewClient[struct{}](nil)
+	if routerOf(a.mc) != routerOf(b.mc) {
+		t.Error("router must be shared by the mqtt.Client")
+	}
+}
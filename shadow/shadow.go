@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: Apache-2.0
+package shadow
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/shirou/aws-iot-device-lib/internal/mqttutils"
+)
+
+// Shadow is a client bound to a single shadow of a thing.
+// An empty ShadowName means the classic (unnamed) shadow.
+type Shadow[T any] struct {
+	client     *Client[T]
+	ThingName  string
+	ShadowName string
+}
+
+// Shadow returns a Shadow of the thing. If shadowName is empty, the classic shadow is used.
+func (client *Client[T]) Shadow(thingName string, shadowName string) *Shadow[T] {
+	return &Shadow[T]{
+		client:     client,
+		ThingName:  thingName,
+		ShadowName: shadowName,
+	}
+}
+
+// NamedShadows returns Shadows of the thing for each of shadowNames. All of them share the same mqtt.Client.
+func (client *Client[T]) NamedShadows(thingName string, shadowNames ...string) []*Shadow[T] {
+	ret := make([]*Shadow[T], 0, len(shadowNames))
+	for _, name := range shadowNames {
+		ret = append(ret, client.Shadow(thingName, name))
+	}
+	return ret
+}
+
+// topicPrefix returns the topic prefix of the shadow.
+func topicPrefix(thingName string, shadowName string) string {
+	if shadowName == "" {
+		return fmt.Sprintf("$aws/things/%s/shadow", thingName)
+	}
+	return fmt.Sprintf("$aws/things/%s/shadow/name/%s", thingName, shadowName)
+}
+
+func (s *Shadow[T]) topicPrefix() string {
+	return topicPrefix(s.ThingName, s.ShadowName)
+}
+
+// raw returns an untyped Shadow sharing the same mqtt.Client.
+func (s *Shadow[T]) raw() *Shadow[map[string]any] {
+	client := &Client[map[string]any]{
+		mc:       s.client.mc,
+		Timeouts: s.client.Timeouts,
+	}
+	return client.Shadow(s.ThingName, s.ShadowName)
+}
+
+// Get gets the shadow document.
+func (s *Shadow[T]) Get(ctx context.Context, req GetShadowInput) (ret GetShadowOutput[T], err error) {
+	req.ClientToken = newClientToken(req.ClientToken)
+	return request[T, GetShadowOutput[T]](ctx, s.client, s.topicPrefix(), "get", req.ClientToken, req)
+}
+
+// Update creates the shadow if it doesn't exist, or updates the contents of an existing shadow with the state information provided in the request.
+func (s *Shadow[T]) Update(ctx context.Context, req UpdateShadowInput[T]) (ret UpdateShadowOutput[T], err error) {
+	req.ClientToken = newClientToken(req.ClientToken)
+	return request[T, UpdateShadowOutput[T]](ctx, s.client, s.topicPrefix(), "update", req.ClientToken, req)
+}
+
+// Delete deletes the shadow document.
+func (s *Shadow[T]) Delete(ctx context.Context, req DeleteShadowInput) (ret DeleteShadowOutput, err error) {
+	req.ClientToken = newClientToken(req.ClientToken)
+	return request[T, DeleteShadowOutput](ctx, s.client, s.topicPrefix(), "delete", req.ClientToken, req)
+}
+
+// GetAll gets the documents of all shadows concurrently. The result is keyed by the shadow name.
+// Shadows which failed are not contained in the result, and their errors are joined.
+func GetAll[T any](ctx context.Context, shadows []*Shadow[T]) (map[string]GetShadowOutput[T], error) {
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+	)
+	ret := make(map[string]GetShadowOutput[T], len(shadows))
+	for _, s := range shadows {
+		wg.Add(1)
+		go func(s *Shadow[T]) {
+			defer wg.Done()
+			doc, err := s.Get(ctx, GetShadowInput{})
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.ShadowName, err))
+				return
+			}
+			ret[s.ShadowName] = doc
+		}(s)
+	}
+	wg.Wait()
+
+	return ret, mqttutils.JoinErrors(errs...)
+}
+
+// UpdateAll sends the updates to the shadows concurrently. The updates are keyed by the shadow name.
+// Shadows which failed are not contained in the result, and their errors are joined.
+func UpdateAll[T any](ctx context.Context, shadows []*Shadow[T], updates map[string]UpdateShadowInput[T]) (map[string]UpdateShadowOutput[T], error) {
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+	)
+	ret := make(map[string]UpdateShadowOutput[T], len(updates))
+	for _, s := range shadows {
+		req, ok := updates[s.ShadowName]
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(s *Shadow[T], req UpdateShadowInput[T]) {
+			defer wg.Done()
+			doc, err := s.Update(ctx, req)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.ShadowName, err))
+				return
+			}
+			ret[s.ShadowName] = doc
+		}(s, req)
+	}
+	wg.Wait()
+
+	return ret, mqttutils.JoinErrors(errs...)
+}
@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: Apache-2.0
+package shadow
+
+import "encoding/json"
+
+// ShadowState represents the state section of a shadow document.
+// T is the user defined state struct. Fields of T should be pointers or have
+// omitempty so that partial documents like delta can be represented.
+// https://docs.aws.amazon.com/iot/latest/developerguide/device-shadow-document.html
+type ShadowState[T any] struct {
+	// The desired state of the device. Applications write to this section to
+	// request changes.
+	Desired *T `json:"desired,omitempty"`
+
+	// The reported state of the device. Devices write to this section to
+	// report their current state.
+	Reported *T `json:"reported,omitempty"`
+
+	// The difference between the desired and reported state. It is only
+	// contained in documents returned by the service.
+	Delta *T `json:"delta,omitempty"`
+}
+
+// Metadata contains the timestamp of each attribute in the state section.
+type Metadata struct {
+	Desired  map[string]any `json:"desired,omitempty"`
+	Reported map[string]any `json:"reported,omitempty"`
+}
+
+type GetShadowInput struct {
+	ClientToken string `json:"clientToken,omitempty"`
+}
+
+type GetShadowOutput[T any] struct {
+	State    ShadowState[T] `json:"state"`
+	Metadata Metadata       `json:"metadata"`
+
+	// The current version of the document for the device's shadow.
+	Version int64 `json:"version"`
+
+	ClientToken string `json:"clientToken"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+// UpdateShadowInput is a partial update of the shadow. The service merges it into
+// the current document: objects are merged recursively and null deletes the key.
+type UpdateShadowInput[T any] struct {
+	// Optional. The partial desired state. Zero valued fields of T are sent
+	// unless they are omitted by omitempty.
+	Desired *T
+
+	// Optional. The partial reported state.
+	Reported *T
+
+	// Optional. Dot separated paths like "network.wifi" of the desired state
+	// to be deleted by sending explicit null.
+	DeleteDesired []string
+
+	// Optional. Dot separated paths of the reported state to be deleted.
+	DeleteReported []string
+
+	// Optional. If true, the whole desired section is deleted.
+	// Desired and DeleteDesired are ignored.
+	ClearDesired bool
+
+	// Optional. If true, the whole reported section is deleted.
+	// Reported and DeleteReported are ignored.
+	ClearReported bool
+
+	// Optional. If specified, the update is rejected with 409 if the version
+	// does not match the latest version of the shadow.
+	Version *int64
+
+	ClientToken string
+}
+
+// MarshalJSON builds the request document with explicit nulls for deleted paths.
+func (req UpdateShadowInput[T]) MarshalJSON() ([]byte, error) {
+	state := make(map[string]any)
+	if req.ClearDesired {
+		state["desired"] = nil
+	} else {
+		desired, err := partialState(req.Desired, req.DeleteDesired)
+		if err != nil {
+			return nil, err
+		}
+		if desired != nil {
+			state["desired"] = desired
+		}
+	}
+	if req.ClearReported {
+		state["reported"] = nil
+	} else {
+		reported, err := partialState(req.Reported, req.DeleteReported)
+		if err != nil {
+			return nil, err
+		}
+		if reported != nil {
+			state["reported"] = reported
+		}
+	}
+
+	return json.Marshal(struct {
+		State       map[string]any `json:"state"`
+		Version     *int64         `json:"version,omitempty"`
+		ClientToken string         `json:"clientToken,omitempty"`
+	}{
+		State:       state,
+		Version:     req.Version,
+		ClientToken: req.ClientToken,
+	})
+}
+
+type UpdateShadowOutput[T any] struct {
+	// The state which was sent in the request.
+	State    ShadowState[T] `json:"state"`
+	Metadata Metadata       `json:"metadata"`
+
+	// The version of the document after the update.
+	Version int64 `json:"version"`
+
+	ClientToken string `json:"clientToken"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+type DeleteShadowInput struct {
+	// Optional. If specified, the delete is rejected with 409 if the version
+	// does not match the latest version of the shadow.
+	Version *int64 `json:"version,omitempty"`
+
+	ClientToken string `json:"clientToken,omitempty"`
+}
+
+type DeleteShadowOutput struct {
+	// The version of the deleted document.
+	Version int64 `json:"version"`
+
+	ClientToken string `json:"clientToken"`
+	Timestamp   int64  `json:"timestamp"`
+}